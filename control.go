@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	controlStart   = "start"
+	controlStop    = "stop"
+	controlRestart = "restart"
+	controlStatus  = "status"
+	controlDump    = "dump"
+	controlReload  = "reload"
+)
+
+var (
+	errNoSupervisor = errors.New("no supervising PRUNSRV process")
+	errControlInUse = errors.New("control socket is already in use by another PRUNSRV process")
+)
+
+// ControlResponse is the answer of the supervising PRUNSRV process to a control command
+type ControlResponse struct {
+	Ok      bool           `json:"Ok"`
+	Message string         `json:"Message,omitempty"`
+	Status  *ServiceStatus `json:"Status,omitempty"`
+}
+
+func controlDir() string {
+	switch runtime.GOOS {
+	case "windows":
+		return configDir()
+	case "linux":
+		return filepath.Join(string(filepath.Separator), "run", title())
+	default:
+		return filepath.Join(string(filepath.Separator), "var", "run", title())
+	}
+}
+
+// runtimeDirs returns the directories of the runtime files of the service in the order they are tried. On *nix each
+// service has a directory of its own in controlDir, which systemd creates for a ServiceUser, a PRUNSRV process
+// without root privileges falls back to the runtime directory of its user
+func (p *Prunsrv) runtimeDirs() []string {
+	if isWindowsOS() {
+		return []string{controlDir()}
+	}
+
+	dirs := []string{filepath.Join(controlDir(), p.DisplayName)}
+
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir != "" {
+		dirs = append(dirs, filepath.Join(dir, title(), p.DisplayName))
+	}
+
+	return dirs
+}
+
+// controlFilenames returns the control socket filenames in the order they are tried
+func (p *Prunsrv) controlFilenames() []string {
+	var filenames []string
+
+	for _, dir := range p.runtimeDirs() {
+		filenames = append(filenames, p.configFilename(dir, ".sock"))
+	}
+
+	return filenames
+}
+
+// controlTimeout is the maximum time a control command may take, a stop and a start of the service process
+func (p *Prunsrv) controlTimeout() time.Duration {
+	return p.startTimeout() + p.stopSequenceTimeout() + 10*time.Second
+}
+
+// controlPermissions restricts the access of the control socket to root and the ControlGroup
+func (p *Prunsrv) controlPermissions(filename string) error {
+	if isWindowsOS() {
+		return nil
+	}
+
+	if p.ControlGroup == "" {
+		return os.Chmod(filename, 0600)
+	}
+
+	group, err := user.LookupGroup(p.ControlGroup)
+	if err != nil {
+		return err
+	}
+
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chown(filename, -1, gid)
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(filename, 0660)
+}
+
+// listenControl serves the control commands of other PRUNSRV invocations on a unix domain socket
+func (p *Prunsrv) listenControl() error {
+	debug("listenControl")
+
+	var errs []string
+
+	for _, filename := range p.controlFilenames() {
+		listener, err := p.listenControlFile(filename)
+		if errors.Is(err, errControlInUse) {
+			return err
+		}
+
+		if err != nil {
+			debug("listenControl:", err)
+
+			errs = append(errs, err.Error())
+
+			continue
+		}
+
+		info("control socket:", filename)
+
+		p.serveControlListener(listener)
+
+		return nil
+	}
+
+	return fmt.Errorf("cannot create the control socket: %s", strings.Join(errs, "; "))
+}
+
+func (p *Prunsrv) listenControlFile(filename string) (net.Listener, error) {
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileExists(filename) {
+		conn, err := net.DialTimeout("unix", filename, time.Second)
+		if err == nil {
+			conn.Close()
+
+			return nil, fmt.Errorf("%w: %s", errControlInUse, filename)
+		}
+
+		err = os.Remove(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.controlPermissions(filename)
+	if err != nil {
+		listener.Close()
+		os.Remove(filename)
+
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func (p *Prunsrv) serveControlListener(listener net.Listener) {
+	p.Mu.Lock()
+	p.Control = listener
+	p.Mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go p.serveControl(conn)
+		}
+	}()
+}
+
+func (p *Prunsrv) closeControl() {
+	p.Mu.Lock()
+	listener := p.Control
+	p.Control = nil
+	p.Mu.Unlock()
+
+	if listener == nil {
+		return
+	}
+
+	debug("closeControl")
+
+	// closing a unix listener removes the socket file
+	checkError(listener.Close())
+}
+
+func (p *Prunsrv) serveControl(conn net.Conn) {
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	command := strings.TrimSpace(line)
+
+	info("control command:", command)
+
+	response := p.executeControl(command)
+
+	ba, err := json.Marshal(response)
+	if checkError(err) {
+		return
+	}
+
+	conn.Write(append(ba, '\n'))
+}
+
+func (p *Prunsrv) executeControl(command string) *ControlResponse {
+	// the status is answered while another control command is executed
+	if command == controlStatus {
+		return &ControlResponse{Ok: true, Status: p.supervisedStatus()}
+	}
+
+	// control commands are executed one after another
+	p.ControlMu.Lock()
+	defer p.ControlMu.Unlock()
+
+	if p.isStopping() {
+		return &ControlResponse{Message: "service is stopping"}
+	}
+
+	var err error
+	var msg string
+
+	switch command {
+	case controlStart:
+		msg, err = p.controlStart()
+	case controlStop:
+		msg, err = p.controlStop()
+	case controlRestart:
+		msg, err = p.controlStop()
+		if err == nil {
+			msg, err = p.controlStart()
+		}
+	case controlDump:
+		msg, err = p.controlDump()
+	case controlReload:
+		msg, err = p.controlReload()
+	default:
+		err = fmt.Errorf("unknown control command: %s", command)
+	}
+
+	if err != nil {
+		return &ControlResponse{Message: err.Error()}
+	}
+
+	return &ControlResponse{Ok: true, Message: msg}
+}
+
+// supervisedStatus is the status of the service process as known by the supervising PRUNSRV process
+func (p *Prunsrv) supervisedStatus() *ServiceStatus {
+	// the own state of the supervising PRUNSRV process is more recent than the state file
+	p.Mu.Lock()
+	hold := p.Hold
+	state := p.State
+	p.Mu.Unlock()
+
+	ss := p.serviceStatus(&state)
+
+	if hold {
+		ss.Status = statusStopped
+		ss.Pid = 0
+		ss.Started = ""
+		ss.Uptime = ""
+		ss.Cpu = ""
+		ss.Rss = 0
+		ss.Health = ""
+	}
+
+	return ss
+}
+
+func (p *Prunsrv) controlStop() (string, error) {
+	p.Mu.Lock()
+	if p.Hold {
+		p.Mu.Unlock()
+
+		return "service process is already stopped", nil
+	}
+
+	heldCh := make(chan struct{})
+
+	p.Hold = true
+	p.HeldCh = heldCh
+	cmd := p.StartCmd
+	exitCh := p.ExitCh
+	p.Mu.Unlock()
+
+	var err error
+
+	if cmd != nil && cmd.Process != nil {
+		err = p.stopProcess(cmd.Process.Pid, exitCh)
+		if err != nil {
+			p.killProcessTree(cmd.Process.Pid)
+
+			treeErr := p.awaitProcessTree(cmd.Process.Pid, 5*time.Second)
+			if treeErr != nil {
+				err = treeErr
+			}
+		}
+	}
+
+	// wait until supervise has noticed the stop, so a following start is not mistaken for a crash
+	select {
+	case <-heldCh:
+	case <-p.StopCh:
+		return "", fmt.Errorf("service is stopping")
+	}
+
+	if checkError(err) {
+		return "", err
+	}
+
+	if cmd == nil || cmd.Process == nil {
+		return "service process is stopped", nil
+	}
+
+	return fmt.Sprintf("service process %d stopped", cmd.Process.Pid), nil
+}
+
+func (p *Prunsrv) controlStart() (string, error) {
+	startedCh := make(chan error, 1)
+
+	p.Mu.Lock()
+	if !p.Hold {
+		p.Mu.Unlock()
+
+		return "service process is already running", nil
+	}
+
+	p.Hold = false
+	p.StartedCh = startedCh
+	p.Mu.Unlock()
+
+	select {
+	case p.ResumeCh <- struct{}{}:
+	default:
+	}
+
+	var err error
+
+	select {
+	case err = <-startedCh:
+	case <-p.StopCh:
+		return "", fmt.Errorf("service is stopping")
+	}
+
+	if checkError(err) {
+		return "", err
+	}
+
+	p.Mu.Lock()
+	pid := p.StartCmd.Process.Pid
+	p.Mu.Unlock()
+
+	return fmt.Sprintf("service process %d started", pid), nil
+}
+
+func (p *Prunsrv) controlDump() (string, error) {
+	p.Mu.Lock()
+	hold := p.Hold
+	cmd := p.StartCmd
+	p.Mu.Unlock()
+
+	if hold || cmd == nil || cmd.Process == nil {
+		return "", fmt.Errorf("service process is not running")
+	}
+
+	if p.startMode() != modeJava {
+		return "", fmt.Errorf("thread dumps are only supported in %q mode", modeJava)
+	}
+
+	p.threadDump(cmd.Process.Pid)
+
+	return fmt.Sprintf("thread dump of service process %d requested", cmd.Process.Pid), nil
+}
+
+// control sends the command to the supervising PRUNSRV process,
+// errNoSupervisor is returned if there is none
+func (p *Prunsrv) control(command string) (*ControlResponse, error) {
+	debug("control:", command)
+
+	var conn net.Conn
+	var err error
+
+	for _, filename := range p.controlFilenames() {
+		conn, err = net.DialTimeout("unix", filename, time.Second)
+		if err == nil {
+			break
+		}
+
+		debug("control:", err)
+
+		// only a missing control socket or one without a listener means there is no supervising PRUNSRV process
+		if !errors.Is(err, os.ErrNotExist) && !isConnectionRefused(err) {
+			return nil, err
+		}
+	}
+
+	if conn == nil {
+		return nil, errNoSupervisor
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(p.controlTimeout()))
+	if checkError(err) {
+		return nil, err
+	}
+
+	_, err = fmt.Fprintln(conn, command)
+	if checkError(err) {
+		return nil, err
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if checkError(err) {
+		return nil, err
+	}
+
+	response := &ControlResponse{}
+
+	err = json.Unmarshal([]byte(line), response)
+	if checkError(err) {
+		return nil, err
+	}
+
+	if !response.Ok {
+		return nil, fmt.Errorf("%s", response.Message)
+	}
+
+	return response, nil
+}
+
+// status returns the status of the service by the supervising PRUNSRV process if there is one
+func (p *Prunsrv) status() *ServiceStatus {
+	response, err := p.control(controlStatus)
+	if err == nil && response.Status != nil {
+		return response.Status
+	}
+
+	return p.queryStatus()
+}
+
+func (p *Prunsrv) dumpService() error {
+	debug("dumpService")
+
+	response, err := p.control(controlDump)
+	if checkError(err) {
+		return err
+	}
+
+	fmt.Println(response.Message)
+
+	return nil
+}
@@ -1,6 +1,6 @@
 module prunsrv
 
-go 1.19
+go 1.20
 
 require (
 	github.com/kardianos/service v1.2.2
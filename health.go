@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	healthTcp  = "tcp"
+	healthHttp = "http"
+	healthExec = "exec"
+
+	healthUnknown   = "unknown"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+)
+
+type HealthCheck struct {
+	Mode  string
+	Value string
+}
+
+func (hc HealthCheck) String() string {
+	return fmt.Sprintf("%s:%s", hc.Mode, hc.Value)
+}
+
+func (p *Prunsrv) healthCheck() (*HealthCheck, error) {
+	s := strings.TrimSpace(p.HealthCheck)
+	if s == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return &HealthCheck{Mode: healthHttp, Value: s}, nil
+	}
+
+	hc := &HealthCheck{
+		Mode: strings.ToLower(s),
+	}
+
+	pos := strings.Index(s, ":")
+	if pos != -1 {
+		hc.Mode = strings.ToLower(s[:pos])
+		hc.Value = strings.TrimSpace(s[pos+1:])
+	}
+
+	switch hc.Mode {
+	case healthTcp:
+		if hc.Value == "" {
+			return nil, fmt.Errorf("invalid HealthCheck, expected tcp:[host:]port: %s", s)
+		}
+
+		if !strings.Contains(hc.Value, ":") {
+			hc.Value = net.JoinHostPort("localhost", hc.Value)
+		}
+	case healthHttp:
+		if hc.Value == "" {
+			hc.Value = p.HealthUrl
+		}
+
+		if hc.Value == "" {
+			return nil, fmt.Errorf("invalid HealthCheck, expected http:URL or HealthUrl: %s", s)
+		}
+	case healthExec:
+		if len(strings.Fields(hc.Value)) == 0 {
+			return nil, fmt.Errorf("invalid HealthCheck, expected exec:COMMAND: %s", s)
+		}
+	default:
+		return nil, fmt.Errorf("unknown HealthCheck mode: %s", hc.Mode)
+	}
+
+	return hc, nil
+}
+
+func (p *Prunsrv) healthInterval() time.Duration {
+	return parseDuration(p.HealthInterval, 30*time.Second)
+}
+
+func (p *Prunsrv) healthTimeout() time.Duration {
+	return parseDuration(p.HealthTimeout, 5*time.Second)
+}
+
+func (p *Prunsrv) healthThreshold() (int, error) {
+	threshold, err := parseInt(p.HealthThreshold, 3)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(threshold, 1), nil
+}
+
+// probe runs the health check once, a nil error reports the service as healthy
+func (p *Prunsrv) probe(hc *HealthCheck, timeout time.Duration) error {
+	switch hc.Mode {
+	case healthTcp:
+		conn, err := net.DialTimeout("tcp", hc.Value, timeout)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	case healthHttp:
+		return p.httpRequest(http.MethodGet, hc.Value, "", timeout)
+	case healthExec:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		fields := strings.Fields(hc.Value)
+
+		ba, err := exec.CommandContext(ctx, fields[0], fields[1:]...).CombinedOutput()
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s timed out after %v", fields[0], timeout)
+		}
+		if err != nil {
+			output := strings.TrimSpace(string(ba))
+			if output != "" {
+				return fmt.Errorf("%s failed: %v: %s", fields[0], err, output)
+			}
+
+			return fmt.Errorf("%s failed: %v", fields[0], err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown HealthCheck mode: %s", hc.Mode)
+}
+
+// threadDump asks the JVM of the service process to print its threads, on *nix the
+// JVM writes the dump to stdout on SIGQUIT, on Windows jstack of the Java runtime is used
+func (p *Prunsrv) threadDump(pid int) {
+	debug("threadDump:", pid)
+
+	if p.startMode() != modeJava {
+		return
+	}
+
+	if !isWindowsOS() {
+		process := findProcess(pid)
+		if process == nil {
+			return
+		}
+
+		if !checkError(process.Signal(syscall.SIGQUIT)) {
+			info(fmt.Sprintf("thread dump of service process %d requested, it is written to the service stdout", pid))
+
+			// give the JVM the chance to write the dump before it is stopped
+			time.Sleep(time.Second)
+		}
+
+		return
+	}
+
+	jr, err := p.resolveJavaRuntime()
+	if checkError(err) {
+		return
+	}
+
+	path := filepath.Join(jr.Home, "bin", "jstack.exe")
+	if !fileExists(path) {
+		warn("no thread dump of service process, missing", path)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.healthTimeout())
+	defer cancel()
+
+	ba, err := exec.CommandContext(ctx, path, "-l", strconv.Itoa(pid)).CombinedOutput()
+	if checkError(err) {
+		return
+	}
+
+	info(fmt.Sprintf("thread dump of service process %d:\n%s", pid, string(ba)))
+}
+
+// monitorHealth probes the service process every HealthInterval until it terminates.
+// After HealthThreshold consecutive failures a thread dump is taken and the service
+// process is stopped, so it is restarted by supervise.
+func (p *Prunsrv) monitorHealth(hc *HealthCheck, pid int, exitCh chan struct{}) {
+	debug("monitorHealth:", hc)
+
+	threshold, err := p.healthThreshold()
+	if checkError(err) {
+		return
+	}
+
+	interval := p.healthInterval()
+	timeout := p.healthTimeout()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		select {
+		case <-exitCh:
+			return
+		case <-p.StopCh:
+			return
+		case <-ticker.C:
+		}
+
+		err := p.probe(hc, timeout)
+
+		select {
+		case <-exitCh:
+			return
+		default:
+		}
+
+		if err == nil {
+			if failures > 0 {
+				info(fmt.Sprintf("health check (%v) of service process %d succeeded after %d failures", hc, pid, failures))
+			} else {
+				debug(fmt.Sprintf("health check (%v) of service process %d succeeded", hc, pid))
+			}
+
+			failures = 0
+
+			p.updateHealth(healthHealthy, 0, nil)
+
+			continue
+		}
+
+		failures++
+
+		warn(fmt.Sprintf("health check (%v) of service process %d failed %d/%d: %v", hc, pid, failures, threshold, err))
+
+		if failures < threshold {
+			p.updateHealth("", failures, err)
+
+			continue
+		}
+
+		p.updateHealth(healthUnhealthy, failures, err)
+
+		if p.isStopping() {
+			return
+		}
+
+		warn(fmt.Sprintf("service process %d is unhealthy, will now restart it", pid))
+
+		p.threadDump(pid)
+
+		p.Mu.Lock()
+		p.ForceRestart = true
+		p.State.HealthRestarts++
+		p.Mu.Unlock()
+
+		checkError(p.saveState())
+
+		if p.stopProcess(pid, exitCh) != nil {
+			p.killProcessTree(pid)
+		}
+
+		return
+	}
+}
+
+// updateHealth records the result of a health check in the state file, an empty health keeps the previous one
+func (p *Prunsrv) updateHealth(health string, failures int, err error) {
+	p.Mu.Lock()
+	if health != "" {
+		p.State.Health = health
+	}
+	p.State.HealthFailures = failures
+	p.State.HealthChecked = time.Now()
+	p.State.HealthError = ""
+	if err != nil {
+		p.State.HealthError = err.Error()
+	}
+	p.Mu.Unlock()
+
+	checkError(p.saveState())
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (p *Prunsrv) httpClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	insecure, _ := strconv.ParseBool(p.HttpInsecure)
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// matchStatus checks the HTTP status code against a ";" separated list like "200;204" or "2xx"
+func matchStatus(code int, expected string) bool {
+	if strings.TrimSpace(expected) == "" {
+		expected = "2xx"
+	}
+
+	status := strconv.Itoa(code)
+
+	for _, pattern := range strings.Split(expected, ";") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+		if len(pattern) != len(status) {
+			continue
+		}
+
+		match := true
+		for i := 0; i < len(pattern); i++ {
+			if pattern[i] != 'x' && pattern[i] != status[i] {
+				match = false
+
+				break
+			}
+		}
+
+		if match {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Prunsrv) httpRequest(method string, url string, expected string, timeout time.Duration) error {
+	debug("httpRequest:", method, url)
+
+	req, err := http.NewRequest(method, url, nil)
+	if checkError(err) {
+		return err
+	}
+
+	for _, header := range p.HttpHeaders {
+		pos := strings.Index(header, ":")
+		if pos == -1 {
+			return fmt.Errorf("invalid HTTP header, expected NAME: VALUE: %s", header)
+		}
+
+		req.Header.Add(strings.TrimSpace(header[:pos]), strings.TrimSpace(header[pos+1:]))
+	}
+
+	resp, err := p.httpClient(timeout).Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request %s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if !matchStatus(resp.StatusCode, expected) {
+		return fmt.Errorf("HTTP request %s %s returned unexpected status %s", method, url, resp.Status)
+	}
+
+	debug("httpRequest:", method, url, resp.Status)
+
+	return nil
+}
+
+// stopViaHttp sends the HTTP stop request to the StopUrl of the service process
+func (p *Prunsrv) stopViaHttp(timeout time.Duration) error {
+	debug("stopViaHttp")
+
+	if p.StopUrl == "" {
+		return fmt.Errorf("missing StopUrl for mode %s", modeHttp)
+	}
+
+	method := p.StopHttpMethod
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	err := p.httpRequest(strings.ToUpper(method), p.StopUrl, p.StopStatus, timeout)
+	if err != nil {
+		return err
+	}
+
+	info("stop request sent to", p.StopUrl)
+
+	return nil
+}
+
+// checkHealth requests the HealthUrl of the service process
+func (p *Prunsrv) checkHealth(timeout time.Duration) error {
+	debug("checkHealth")
+
+	if p.HealthUrl != "" {
+		return p.httpRequest(http.MethodGet, p.HealthUrl, "", timeout)
+	}
+
+	hc, err := p.healthCheck()
+	if checkError(err) {
+		return err
+	}
+
+	if hc == nil {
+		return fmt.Errorf("missing HealthUrl or HealthCheck")
+	}
+
+	return p.probe(hc, timeout)
+}
+
+func (p *Prunsrv) healthService() error {
+	debug("healthService")
+
+	state, err := p.loadState()
+	if err == nil && state.HealthCheck != "" {
+		fmt.Printf("Health check:     %s\n", state.HealthCheck)
+		fmt.Printf("Health:           %s\n", state.Health)
+		if !state.HealthChecked.IsZero() {
+			fmt.Printf("Last check:       %s\n", state.HealthChecked.Format(time.RFC3339))
+		}
+		fmt.Printf("Failures:         %d\n", state.HealthFailures)
+		fmt.Printf("Health restarts:  %d\n", state.HealthRestarts)
+		if state.HealthError != "" {
+			fmt.Printf("Last error:       %s\n", state.HealthError)
+		}
+	}
+
+	err = p.checkHealth(p.stopTimeout())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is healthy\n", p.DisplayName)
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchStatus(t *testing.T) {
+	tests := []struct {
+		code     int
+		expected string
+		want     bool
+	}{
+		{200, "", true},
+		{204, "2xx", true},
+		{299, "2XX", true},
+		{301, "2xx", false},
+		{200, "200;204", true},
+		{204, "200; 204", true},
+		{202, "200;204", false},
+		{404, "4x4", true},
+		{500, "5x", false},
+	}
+
+	for _, test := range tests {
+		got := matchStatus(test.code, test.expected)
+		if got != test.want {
+			t.Errorf("matchStatus(%d, %q) = %v, want %v", test.code, test.expected, got, test.want)
+		}
+	}
+}
+
+func TestStopViaHttp(t *testing.T) {
+	var method string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+
+		switch r.URL.Path {
+		case "/stop":
+			w.WriteHeader(http.StatusOK)
+		case "/accepted":
+			w.WriteHeader(http.StatusAccepted)
+		case "/nocontent":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		method  string
+		status  string
+		wantErr bool
+	}{
+		{"/stop", "", "", false},
+		{"/accepted", "", "2xx", false},
+		{"/nocontent", "get", "200;204", false},
+		{"/accepted", "", "200;204", true},
+		{"/unknown", "", "", true},
+	}
+
+	for _, test := range tests {
+		p := &Prunsrv{
+			StopUrl:        server.URL + test.path,
+			StopHttpMethod: test.method,
+			StopStatus:     test.status,
+		}
+
+		err := p.stopViaHttp(time.Second)
+		if (err != nil) != test.wantErr {
+			t.Errorf("stopViaHttp(%s, %q): error = %v, wantErr %v", test.path, test.status, err, test.wantErr)
+		}
+
+		wantMethod := http.MethodPost
+		if test.method != "" {
+			wantMethod = http.MethodGet
+		}
+
+		if method != wantMethod {
+			t.Errorf("stopViaHttp(%s): method = %s, want %s", test.path, method, wantMethod)
+		}
+	}
+
+	p := &Prunsrv{}
+
+	err := p.stopViaHttp(time.Second)
+	if err == nil {
+		t.Errorf("stopViaHttp without StopUrl: expected error")
+	}
+}
+
+func TestHttpHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Stop") != "now" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	p := &Prunsrv{
+		StopUrl:     server.URL,
+		HttpHeaders: []string{"Authorization: Bearer secret", "X-Stop:now"},
+	}
+
+	err := p.stopViaHttp(time.Second)
+	if err != nil {
+		t.Errorf("stopViaHttp with headers: %v", err)
+	}
+
+	p.HttpHeaders = []string{"Authorization: Bearer secret"}
+
+	err = p.stopViaHttp(time.Second)
+	if err == nil {
+		t.Errorf("stopViaHttp with missing header: expected error")
+	}
+
+	p.HttpHeaders = []string{"invalid"}
+
+	err = p.stopViaHttp(time.Second)
+	if err == nil {
+		t.Errorf("stopViaHttp with invalid header: expected error")
+	}
+}
+
+func TestHttpInsecure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	p := &Prunsrv{
+		HealthUrl: server.URL,
+	}
+
+	err := p.checkHealth(time.Second)
+	if err == nil {
+		t.Errorf("checkHealth with self-signed certificate: expected error")
+	}
+
+	p.HttpInsecure = "true"
+
+	err = p.checkHealth(time.Second)
+	if err != nil {
+		t.Errorf("checkHealth with HttpInsecure: %v", err)
+	}
+}
+
+func TestHealthService(t *testing.T) {
+	healthy := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	p := &Prunsrv{
+		DisplayName: "prunsrv-test-health",
+		HealthUrl:   server.URL + "/health",
+		StopTimeout: "1",
+	}
+
+	err := p.healthService()
+	if err != nil {
+		t.Errorf("healthService of a healthy service: %v", err)
+	}
+
+	healthy = false
+
+	err = p.healthService()
+	if err == nil {
+		t.Errorf("healthService of an unhealthy service: expected error")
+	}
+
+	p.HealthUrl = ""
+
+	err = p.healthService()
+	if err == nil {
+		t.Errorf("healthService without HealthUrl or HealthCheck: expected error")
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type JavaRuntime struct {
+	Home    string
+	Version string
+	Vendor  string
+}
+
+var (
+	javaVersionConstraintRegex = regexp.MustCompile(`^(>=|<=|==|=|>|<)?\s*([0-9][0-9._]*)$`)
+	javaVersionOutputRegex     = regexp.MustCompile(`version "([^"]+)"`)
+)
+
+func isJavaHome(home string) bool {
+	return fileExists(filepath.Join(home, "bin", javaExecutable()))
+}
+
+func readJavaRelease(home string) *JavaRuntime {
+	jr := &JavaRuntime{
+		Home: home,
+	}
+
+	f, err := os.Open(filepath.Join(home, "release"))
+	if err != nil {
+		debug("readJavaRelease:", home, "no release file")
+
+		return jr
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		p := strings.Index(line, "=")
+		if p == -1 {
+			continue
+		}
+
+		key := strings.TrimSpace(line[:p])
+		value := strings.Trim(strings.TrimSpace(line[p+1:]), "\"")
+
+		switch key {
+		case "JAVA_VERSION":
+			jr.Version = value
+		case "IMPLEMENTOR":
+			jr.Vendor = value
+		case "JAVA_VENDOR":
+			if jr.Vendor == "" {
+				jr.Vendor = value
+			}
+		}
+	}
+
+	debug("readJavaRelease:", home, jr.Version, jr.Vendor)
+
+	return jr
+}
+
+func readJavaVersionOutput(home string) string {
+	path := filepath.Join(home, "bin", javaExecutable())
+	if !fileExists(path) {
+		return ""
+	}
+
+	ba, err := exec.Command(path, "-version").CombinedOutput()
+	if err != nil {
+		debug("readJavaVersionOutput:", home, err)
+
+		return ""
+	}
+
+	match := javaVersionOutputRegex.FindStringSubmatch(string(ba))
+	if match == nil {
+		return ""
+	}
+
+	debug("readJavaVersionOutput:", home, match[1])
+
+	return match[1]
+}
+
+func readJavaRuntime(home string) *JavaRuntime {
+	jr := readJavaRelease(home)
+
+	if jr.Version == "" {
+		jr.Version = readJavaVersionOutput(home)
+	}
+
+	return jr
+}
+
+func (jr *JavaRuntime) MajorVersion() int {
+	v := parseJavaVersion(jr.Version)
+	if len(v) == 0 {
+		return 0
+	}
+
+	return v[0]
+}
+
+func parseJavaVersion(version string) []int {
+	var numbers []int
+
+	for _, s := range strings.FieldsFunc(version, func(r rune) bool {
+		return r == '.' || r == '_' || r == '-' || r == '+'
+	}) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			break
+		}
+
+		numbers = append(numbers, n)
+	}
+
+	// Java 8 and older report "1.8.0_292"
+	if len(numbers) > 1 && numbers[0] == 1 {
+		numbers = numbers[1:]
+	}
+
+	return numbers
+}
+
+func compareJavaVersions(v0 []int, v1 []int) int {
+	for i := 0; i < max(len(v0), len(v1)); i++ {
+		var n0, n1 int
+
+		if i < len(v0) {
+			n0 = v0[i]
+		}
+		if i < len(v1) {
+			n1 = v1[i]
+		}
+
+		switch {
+		case n0 < n1:
+			return -1
+		case n0 > n1:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func matchJavaVersion(version string, constraints string) (bool, error) {
+	if strings.TrimSpace(constraints) == "" {
+		return true, nil
+	}
+
+	v := parseJavaVersion(version)
+	if len(v) == 0 {
+		return false, nil
+	}
+
+	for _, constraint := range strings.Split(constraints, ",") {
+		constraint = strings.TrimSpace(constraint)
+
+		match := javaVersionConstraintRegex.FindStringSubmatch(constraint)
+		if match == nil {
+			return false, fmt.Errorf("invalid Java version constraint: %s", constraint)
+		}
+
+		c := parseJavaVersion(match[2])
+
+		var ok bool
+
+		switch match[1] {
+		case ">=":
+			ok = compareJavaVersions(v, c) >= 0
+		case "<=":
+			ok = compareJavaVersions(v, c) <= 0
+		case ">":
+			ok = compareJavaVersions(v, c) > 0
+		case "<":
+			ok = compareJavaVersions(v, c) < 0
+		default:
+			ok = compareJavaVersions(v[:min(len(v), len(c))], c) == 0
+		}
+
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// javaCandidates returns the Java homes in the order they are evaluated
+func javaCandidates() []string {
+	var homes []string
+
+	if home := os.Getenv("JAVA_HOME"); home != "" {
+		homes = append(homes, home)
+	}
+
+	path, err := exec.LookPath(javaExecutable())
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+		if err == nil {
+			homes = append(homes, filepath.Dir(filepath.Dir(path)))
+		}
+	}
+
+	if runtime.GOOS == "linux" {
+		for _, pattern := range []string{"/usr/lib/jvm/*", "/opt/java/*"} {
+			dirs, _ := filepath.Glob(pattern)
+
+			// sort by the release file only, "java -version" is only run on the candidates which are evaluated
+			versions := make(map[string][]int)
+			for _, dir := range dirs {
+				versions[dir] = parseJavaVersion(readJavaRelease(dir).Version)
+			}
+
+			sort.SliceStable(dirs, func(i, j int) bool {
+				return compareJavaVersions(versions[dirs[i]], versions[dirs[j]]) > 0
+			})
+
+			homes = append(homes, dirs...)
+		}
+	}
+
+	debug("javaCandidates:", homes)
+
+	return homes
+}
+
+func (p *Prunsrv) matchJavaRuntime(jr *JavaRuntime) (bool, error) {
+	ok, err := matchJavaVersion(jr.Version, p.JavaVersion)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if p.JavaVendor != "" && !strings.Contains(strings.ToLower(jr.Vendor), strings.ToLower(p.JavaVendor)) {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (p *Prunsrv) resolveJavaRuntime() (*JavaRuntime, error) {
+	if p.JavaRuntime != nil {
+		return p.JavaRuntime, nil
+	}
+
+	if p.JavaHome != "" {
+		jr := readJavaRuntime(p.JavaHome)
+
+		ok, err := p.matchJavaRuntime(jr)
+		if checkError(err) {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("Java runtime %s (version: %s, vendor: %s) does not match JavaVersion %q and JavaVendor %q", jr.Home, jr.Version, jr.Vendor, p.JavaVersion, p.JavaVendor)
+		}
+
+		p.JavaRuntime = jr
+
+		return jr, nil
+	}
+
+	for _, home := range javaCandidates() {
+		if !isJavaHome(home) {
+			continue
+		}
+
+		jr := readJavaRuntime(home)
+
+		ok, err := p.matchJavaRuntime(jr)
+		if checkError(err) {
+			return nil, err
+		}
+
+		if ok {
+			debug("resolveJavaRuntime:", jr.Home, jr.Version, jr.Vendor)
+
+			p.JavaRuntime = jr
+
+			return jr, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no Java runtime found matching JavaVersion %q and JavaVendor %q", p.JavaVersion, p.JavaVendor)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJavaVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []int
+	}{
+		{"1.8.0_292", []int{8, 0, 292}},
+		{"11.0.2", []int{11, 0, 2}},
+		{"17", []int{17}},
+		{"21.0.1+12", []int{21, 0, 1, 12}},
+		{"22-ea", []int{22}},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		got := parseJavaVersion(test.version)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseJavaVersion(%q) = %v, want %v", test.version, got, test.want)
+		}
+	}
+}
+
+func TestMatchJavaVersion(t *testing.T) {
+	tests := []struct {
+		version     string
+		constraints string
+		want        bool
+		wantErr     bool
+	}{
+		{"17.0.2", "", true, false},
+		{"17.0.2", ">=17", true, false},
+		{"17.0.2", ">=17,<22", true, false},
+		{"22.0.1", ">=17,<22", false, false},
+		{"1.8.0_292", "<9", true, false},
+		{"1.8.0_292", "8", true, false},
+		{"11.0.2", "=11", true, false},
+		{"11.0.2", "==11.0", true, false},
+		{"11.0.2", "11.0.3", false, false},
+		{"21", ">17", true, false},
+		{"17", ">17", false, false},
+		{"17.0.9", "<=17.0.9", true, false},
+		{"", ">=17", false, false},
+		{"17", "~17", false, true},
+		{"17", ">=seventeen", false, true},
+	}
+
+	for _, test := range tests {
+		got, err := matchJavaVersion(test.version, test.constraints)
+		if (err != nil) != test.wantErr {
+			t.Errorf("matchJavaVersion(%q, %q): error = %v, wantErr %v", test.version, test.constraints, err, test.wantErr)
+
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("matchJavaVersion(%q, %q) = %v, want %v", test.version, test.constraints, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJson = "json"
+
+	componentPrunsrv = "prunsrv"
+)
+
+var (
+	logFormat  = logFormatText
+	logService string
+	logPid     atomic.Int64
+)
+
+type LogRecord struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Service   string `json:"service"`
+	Component string `json:"component"`
+	Pid       int64  `json:"pid,omitempty"`
+	Message   string `json:"message"`
+}
+
+func parseLogFormat(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", logFormatText:
+		return logFormatText, nil
+	case logFormatJson:
+		return logFormatJson, nil
+	default:
+		return "", fmt.Errorf("unknown log format: %s", s)
+	}
+}
+
+func formatLogRecord(level string, component string, pid int64, msg string) string {
+	ba, err := json.Marshal(LogRecord{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Level:     level,
+		Service:   logService,
+		Component: component,
+		Pid:       pid,
+		Message:   msg,
+	})
+	if err != nil {
+		return msg
+	}
+
+	return string(ba)
+}
+
+func formatLog(level int, msg string) string {
+	if logFormat == logFormatJson {
+		return formatLogRecord(levelNames[level], componentPrunsrv, logPid.Load(), msg)
+	}
+
+	return fmt.Sprintf("%s %s", levelNames[level], msg)
+}
+
+// RecordWriter writes each line of the child process output as a JSON log record
+type RecordWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	component string
+	level     string
+	pid       atomic.Int64
+	buf       bytes.Buffer
+}
+
+// NewRecordWriter creates a RecordWriter for the output component "stdout" or "stderr",
+// lines written to stderr are logged with level WARN
+func NewRecordWriter(w io.Writer, component string) *RecordWriter {
+	level := levelNames[levelInfo]
+	if component == "stderr" {
+		level = levelNames[levelWarn]
+	}
+
+	return &RecordWriter{
+		w:         w,
+		component: component,
+		level:     level,
+	}
+}
+
+func (rw *RecordWriter) SetPid(pid int) {
+	rw.pid.Store(int64(pid))
+}
+
+func (rw *RecordWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.buf.Write(p)
+
+	for {
+		line, err := rw.buf.ReadString('\n')
+		if err != nil {
+			// incomplete line, keep it for the next write
+			rw.buf.Reset()
+			rw.buf.WriteString(line)
+
+			break
+		}
+
+		err = rw.writeRecord(line)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (rw *RecordWriter) writeRecord(line string) error {
+	_, err := fmt.Fprintln(rw.w, formatLogRecord(rw.level, rw.component, rw.pid.Load(), strings.TrimRight(line, "\r\n")))
+
+	return err
+}
+
+// Close writes a last line without a newline, so the last message of a crashed child process is not lost
+func (rw *RecordWriter) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.buf.Len() == 0 {
+		return nil
+	}
+
+	line := rw.buf.String()
+	rw.buf.Reset()
+
+	return rw.writeRecord(line)
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	logRotateDaily  = "daily"
+	logRotateHourly = "hourly"
+
+	logExt = ".log"
+)
+
+type RotateOptions struct {
+	MaxSize  int64
+	Rotate   string
+	MaxFiles int
+	MaxAge   time.Duration
+	Compress bool
+}
+
+type RotateWriter struct {
+	mu      sync.Mutex
+	base    string
+	dated   bool
+	options RotateOptions
+	f       *os.File
+	size    int64
+	period  string
+}
+
+func (p *Prunsrv) rotateOptions() (RotateOptions, error) {
+	var options RotateOptions
+	var err error
+
+	options.MaxSize, err = parseSize(p.LogMaxSize, 10000000)
+	if checkError(err) {
+		return options, err
+	}
+
+	switch strings.ToLower(p.LogRotate) {
+	case "":
+	case logRotateDaily, logRotateHourly:
+		options.Rotate = strings.ToLower(p.LogRotate)
+	default:
+		return options, fmt.Errorf("unknown log rotation: %s", p.LogRotate)
+	}
+
+	options.MaxFiles, err = parseInt(p.LogMaxFiles, 10)
+	if checkError(err) {
+		return options, err
+	}
+
+	maxAge, err := parseInt(p.LogMaxAge, 0)
+	if checkError(err) {
+		return options, err
+	}
+
+	options.MaxAge = time.Duration(maxAge) * 24 * time.Hour
+
+	if p.LogCompress != "" {
+		options.Compress, err = strconv.ParseBool(p.LogCompress)
+		if checkError(err) {
+			return options, err
+		}
+	}
+
+	return options, nil
+}
+
+func parseSize(s string, def int64) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return def, nil
+	}
+
+	factor := int64(1)
+
+	switch {
+	case strings.HasSuffix(s, "k"):
+		factor = 1024
+	case strings.HasSuffix(s, "m"):
+		factor = 1024 * 1024
+	case strings.HasSuffix(s, "g"):
+		factor = 1024 * 1024 * 1024
+	}
+
+	if factor != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return n * factor, nil
+}
+
+// NewRotateWriter creates a log writer for the file filename.
+// If dated is true the active file is named <base>.<period>.log, otherwise <base>.log is used
+// and renamed to <base>.<period>.log on rotation.
+func NewRotateWriter(filename string, dated bool, options RotateOptions) (*RotateWriter, error) {
+	w := &RotateWriter{
+		base:    strings.TrimSuffix(filename, logExt),
+		dated:   dated,
+		options: options,
+	}
+
+	if w.dated && w.options.Rotate == "" {
+		w.options.Rotate = logRotateDaily
+	}
+
+	err := w.open()
+	if checkError(err) {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *RotateWriter) layout() string {
+	if w.options.Rotate == logRotateHourly {
+		return "2006-01-02-15"
+	}
+
+	return "2006-01-02"
+}
+
+func (w *RotateWriter) activeName(t time.Time) string {
+	if w.dated {
+		return fmt.Sprintf("%s.%s%s", w.base, t.Format(w.layout()), logExt)
+	}
+
+	return w.base + logExt
+}
+
+func (w *RotateWriter) rotatedName(period string) string {
+	filename := fmt.Sprintf("%s.%s%s", w.base, period, logExt)
+
+	for i := 1; fileExists(filename) || fileExists(filename+".gz"); i++ {
+		filename = fmt.Sprintf("%s.%s.%d%s", w.base, period, i, logExt)
+	}
+
+	return filename
+}
+
+// open, rotate and cleanup are called while the prunsrv log itself is written,
+// so they must not log via debug() or checkError()
+
+func (w *RotateWriter) open() error {
+	now := time.Now()
+	filename := w.activeName(now)
+
+	err := os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	w.period = now.Format(w.layout())
+	w.size = 0
+
+	fs, err := os.Stat(filename)
+	if err == nil {
+		w.size = fs.Size()
+
+		if !w.dated && w.options.Rotate != "" {
+			w.period = fs.ModTime().Format(w.layout())
+		}
+	}
+
+	w.f, err = os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, os.ModePerm)
+
+	return err
+}
+
+func (w *RotateWriter) needsRotation(n int) bool {
+	if w.options.Rotate != "" && time.Now().Format(w.layout()) != w.period {
+		return true
+	}
+
+	return w.options.MaxSize > 0 && w.size > 0 && w.size+int64(n) > w.options.MaxSize
+}
+
+func (w *RotateWriter) rotate() error {
+	filename := w.f.Name()
+
+	err := w.f.Close()
+	if err != nil {
+		return err
+	}
+
+	w.f = nil
+
+	rotated := filename
+	if !w.dated || time.Now().Format(w.layout()) == w.period {
+		rotated = w.rotatedName(w.period)
+
+		err = os.Rename(filename, rotated)
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.options.Compress {
+		compressFile(rotated)
+	}
+
+	err = w.open()
+	if err != nil {
+		return err
+	}
+
+	w.cleanup()
+
+	return nil
+}
+
+func (w *RotateWriter) cleanup() {
+	if w.options.MaxFiles <= 0 && w.options.MaxAge <= 0 {
+		return
+	}
+
+	var files []os.FileInfo
+	var names []string
+
+	// the pattern is anchored to the date of the period, so the files of a service whose name
+	// starts with the same prefix (e.g. "app" and "app.api") are not matched
+	date := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return '#'
+		}
+
+		return r
+	}, w.layout())
+
+	prefix := w.base + "." + strings.ReplaceAll(date, "#", "[0-9]") + "*" + logExt
+
+	for _, pattern := range []string{prefix, prefix + ".gz"} {
+		matches, _ := filepath.Glob(pattern)
+
+		for _, match := range matches {
+			if match == w.f.Name() {
+				continue
+			}
+
+			fs, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+
+			files = append(files, fs)
+			names = append(names, match)
+		}
+	}
+
+	indices := make([]int, len(files))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	sort.Slice(indices, func(i, j int) bool {
+		return files[indices[i]].ModTime().After(files[indices[j]].ModTime())
+	})
+
+	for i, index := range indices {
+		tooMany := w.options.MaxFiles > 0 && i >= w.options.MaxFiles
+		tooOld := w.options.MaxAge > 0 && time.Since(files[index].ModTime()) > w.options.MaxAge
+
+		if tooMany || tooOld {
+			os.Remove(names[index])
+		}
+	}
+}
+
+func compressFile(filename string) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(filename+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = dst.Close()
+	} else {
+		dst.Close()
+	}
+
+	if err != nil {
+		os.Remove(filename + ".gz")
+
+		return err
+	}
+
+	src.Close()
+
+	return os.Remove(filename)
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		err := w.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if w.needsRotation(len(p)) {
+		err := w.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.f.Close()
+	w.f = nil
+
+	return err
+}
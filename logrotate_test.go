@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func logFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestRotateWriterMaxSize(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := NewRotateWriter(filepath.Join(dir, "app.log"), false, RotateOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := w.Write([]byte("12345678\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	period := time.Now().Format("2006-01-02")
+
+	want := []string{"app." + period + ".1.log", "app." + period + ".log", "app.log"}
+	got := logFiles(t, dir)
+
+	if len(got) != len(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("files = %v, want %v", got, want)
+
+			break
+		}
+	}
+}
+
+func TestRotateWriterCleanup(t *testing.T) {
+	dir := t.TempDir()
+
+	old := time.Now().Add(-72 * time.Hour)
+
+	// rotated files of this service and files of another service with the same prefix
+	for _, name := range []string{"app.2000-01-01.log", "app.2000-01-02.log.gz", "app.api.log", "app.api.2000-01-01.log", "app.api-stdout.2000-01-01.log"} {
+		filename := filepath.Join(dir, name)
+
+		err := os.WriteFile(filename, []byte("old\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(filename, old, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := NewRotateWriter(filepath.Join(dir, "app.log"), false, RotateOptions{MaxSize: 10, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := w.Write([]byte("12345678\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	period := time.Now().Format("2006-01-02")
+
+	want := []string{"app." + period + ".log", "app.api-stdout.2000-01-01.log", "app.api.2000-01-01.log", "app.api.log", "app.log"}
+	got := logFiles(t, dir)
+
+	if len(got) != len(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("files = %v, want %v", got, want)
+
+			break
+		}
+	}
+}
+
+func TestRotateWriterMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := NewRotateWriter(filepath.Join(dir, "app.log"), false, RotateOptions{MaxSize: 10, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 6; i++ {
+		_, err := w.Write([]byte("12345678\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := logFiles(t, dir)
+
+	// the active file and at most MaxFiles rotated files
+	if len(got) != 3 {
+		t.Errorf("files = %v, want 3 files", got)
+	}
+}
+
+func TestRotateWriterCompress(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := NewRotateWriter(filepath.Join(dir, "app.log"), false, RotateOptions{MaxSize: 10, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := w.Write([]byte("12345678\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	period := time.Now().Format("2006-01-02")
+
+	if !fileExists(filepath.Join(dir, "app."+period+".log.gz")) {
+		t.Errorf("files = %v, want compressed rotated file", logFiles(t, dir))
+	}
+}
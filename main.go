@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -14,49 +15,146 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 type Prunsrv struct {
-	DoTest        bool            `json:"-"`
-	DoService     bool            `json:"-"`
-	DoStart       bool            `json:"-"`
-	DoStop        bool            `json:"-"`
-	DoInstall     bool            `json:"-"`
-	DoUninstall   bool            `json:"-"`
-	DoUpdate      bool            `json:"-"`
-	DoPrint       bool            `json:"-"`
-	ServiceConfig service.Config  `json:"-"`
-	Service       service.Service `json:"-"`
-	StartCmd      *exec.Cmd       `json:"-"`
-	StopCmd       *exec.Cmd       `json:"-"`
+	DoTest        bool                     `json:"-"`
+	DoService     bool                     `json:"-"`
+	DoStart       bool                     `json:"-"`
+	DoStop        bool                     `json:"-"`
+	DoInstall     bool                     `json:"-"`
+	DoUninstall   bool                     `json:"-"`
+	DoUpdate      bool                     `json:"-"`
+	DoPrint       bool                     `json:"-"`
+	DoHealth      bool                     `json:"-"`
+	DoQuery       bool                     `json:"-"`
+	DoList        bool                     `json:"-"`
+	DoDump        bool                     `json:"-"`
+	DoRestart     bool                     `json:"-"`
+	DoReload      bool                     `json:"-"`
+	Output        string                   `json:"-"`
+	Wait          string                   `json:"-"`
+	Direct        bool                     `json:"-"`
+	Elevate       bool                     `json:"-"`
+	ListState     string                   `json:"-"`
+	ServiceConfig service.Config           `json:"-"`
+	Service       service.Service          `json:"-"`
+	StartCmd      *exec.Cmd                `json:"-"`
+	StopCmd       *exec.Cmd                `json:"-"`
+	StartStdin    io.WriteCloser           `json:"-"`
+	JavaRuntime   *JavaRuntime             `json:"-"`
+	LogWriters    map[string]*RotateWriter `json:"-"`
+	RecordWriters map[int][]*RecordWriter  `json:"-"`
+	ExitCh        chan struct{}            `json:"-"`
+	StopCh        chan struct{}            `json:"-"`
+	StartedCh     chan error               `json:"-"`
+	DoneCh        chan struct{}            `json:"-"`
+	ForceRestart  bool                     `json:"-"`
+	Hold          bool                     `json:"-"`
+	HeldCh        chan struct{}            `json:"-"`
+	ResumeCh      chan struct{}            `json:"-"`
+	Control       net.Listener             `json:"-"`
+	ControlMu     sync.Mutex               `json:"-"`
+	State         ServiceState             `json:"-"`
+	ReadyMatched  chan struct{}            `json:"-"`
+	StopOnce      sync.Once                `json:"-"`
+	Mu            sync.Mutex               `json:"-"`
 
 	DisplayName     string   `json:"DisplayName"`
 	Description     string   `json:"Description"`
 	StartPath       string   `json:"StartPath"`
 	Startup         string   `json:"Startup"`
 	JavaHome        string   `json:"JavaHome"`
+	JavaVersion     string   `json:"JavaVersion"`
+	JavaVendor      string   `json:"JavaVendor"`
 	JvmOptions      []string `json:"JvmOptions"`
+	JvmOptions9     []string `json:"JvmOptions9"`
+	Environment     []string `json:"Environment"`
+	EnvInherit      string   `json:"EnvInherit"`
+	EnvAllowlist    []string `json:"EnvAllowlist"`
 	Classpath       string   `json:"Classpath"`
 	JvmMx           string   `json:"JvmMx"`
 	JvmMs           string   `json:"JvmMs"`
 	JvmSs           string   `json:"JvmSs"`
+	StartMode       string   `json:"StartMode"`
+	StopMode        string   `json:"StopMode"`
+	StartImage      string   `json:"StartImage"`
+	StopImage       string   `json:"StopImage"`
+	StartParams     []string `json:"StartParams"`
+	StopParams      []string `json:"StopParams"`
 	StartClass      string   `json:"StartClass"`
 	StopClass       string   `json:"StopClass"`
 	StartMethod     string   `json:"StartMethod"`
 	StopMethod      string   `json:"StopMethod"`
+	ReloadClass     string   `json:"ReloadClass"`
+	ReloadMethod    string   `json:"ReloadMethod"`
+	ReloadSignal    string   `json:"ReloadSignal"`
 	StopTimeout     string   `json:"StopTimeout"`
+	StartReadiness  string   `json:"StartReadiness"`
+	StartTimeout    string   `json:"StartTimeout"`
+	StopSequence    string   `json:"StopSequence"`
+	StopPort        string   `json:"StopPort"`
+	StopHost        string   `json:"StopHost"`
+	StopCommand     string   `json:"StopCommand"`
+	StopStdinText   string   `json:"StopStdinText"`
+	StopUrl         string   `json:"StopUrl"`
+	StopHttpMethod  string   `json:"StopHttpMethod"`
+	StopStatus      string   `json:"StopStatus"`
+	HealthUrl       string   `json:"HealthUrl"`
+	HealthCheck     string   `json:"HealthCheck"`
+	HealthInterval  string   `json:"HealthInterval"`
+	HealthTimeout   string   `json:"HealthTimeout"`
+	HealthThreshold string   `json:"HealthThreshold"`
+	HttpHeaders     []string `json:"HttpHeaders"`
+	HttpInsecure    string   `json:"HttpInsecure"`
+	Cgroup          string   `json:"Cgroup"`
+	ControlGroup    string   `json:"ControlGroup"`
 	LogPath         string   `json:"LogPath"`
 	LogLevel        string   `json:"LogLevel"`
 	LogPrefix       string   `json:"LogPrefix"`
+	LogFormat       string   `json:"LogFormat"`
+	LogMaxSize      string   `json:"LogMaxSize"`
+	LogRotate       string   `json:"LogRotate"`
+	LogMaxFiles     string   `json:"LogMaxFiles"`
+	LogMaxAge       string   `json:"LogMaxAge"`
+	LogCompress     string   `json:"LogCompress"`
 	ServiceUser     string   `json:"ServiceUser"`
 	ServicePassword string   `json:"ServicePassword"`
 	PidFile         string   `json:"PidFile"`
+	StdOutput       string   `json:"StdOutput"`
+	StdError        string   `json:"StdError"`
+	Restart         string   `json:"Restart"`
+	RestartDelay    string   `json:"RestartDelay"`
+	RestartMaxDelay string   `json:"RestartMaxDelay"`
+	RestartMaxCount string   `json:"RestartMaxCount"`
+	RestartWindow   string   `json:"RestartWindow"`
 }
 
 const (
 	version = "1.0.8"
+
+	modeJava  = "java"
+	modeJvm   = "jvm"
+	modeExe   = "exe"
+	modePort  = "port"
+	modeStdin = "stdin"
+	modeHttp  = "http"
+
+	envInheritAll       = "all"
+	envInheritNone      = "none"
+	envInheritAllowlist = "allowlist"
+
+	stdAuto    = "auto"
+	stdInherit = "inherit"
+)
+
+var (
+	jvmModeOnce sync.Once
+
+	defaultEnvAllowlist = []string{"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_ALL", "TZ", "TMPDIR", "TEMP", "TMP", "SystemRoot", "SystemDrive", "windir", "ComSpec", "ProgramData"}
 )
 
 func banner() {
@@ -87,8 +185,6 @@ func usage() {
 func (p *Prunsrv) scanArgs() error {
 	debug("scanArgs")
 
-	var err error
-
 	argValue := func(arg string, i int) (string, int) {
 		p := strings.Index(arg, "=")
 		if p != -1 {
@@ -113,9 +209,27 @@ func (p *Prunsrv) scanArgs() error {
 		panic(fmt.Errorf("missing parameter to argument %s", arg))
 	}
 
+	argValues := func(values []string, arg string, i int) ([]string, int) {
+		var value string
+
+		value, i = argValue(arg, i)
+
+		if strings.HasPrefix(arg, "++") {
+			return append(values, strings.Split(value, ";")...), i
+		}
+
+		return strings.Split(value, ";"), i
+	}
+
 	for i := 1; i < len(os.Args); i++ {
 		arg := strings.TrimSpace(os.Args[i])
 
+		if arg == "--" && p.DoTest {
+			p.StartParams = append(p.StartParams, os.Args[i+1:]...)
+
+			break
+		}
+
 		if strings.HasPrefix(arg, "//TS") {
 			debug("Action:", "testService")
 
@@ -168,6 +282,32 @@ func (p *Prunsrv) scanArgs() error {
 			}
 		}
 
+		if strings.HasPrefix(arg, "//RR") {
+			debug("Action:", "restartService")
+
+			p.DoRestart = true
+
+			p.DisplayName, i = argValue(arg, i)
+
+			err := p.loadConfig(true)
+			if checkError(err) {
+				return err
+			}
+		}
+
+		if strings.HasPrefix(arg, "//RL") {
+			debug("Action:", "reloadService")
+
+			p.DoReload = true
+
+			p.DisplayName, i = argValue(arg, i)
+
+			err := p.loadConfig(true)
+			if checkError(err) {
+				return err
+			}
+		}
+
 		if strings.HasPrefix(arg, "//IS") {
 			debug("Action:", "installService")
 
@@ -229,6 +369,51 @@ func (p *Prunsrv) scanArgs() error {
 			}
 		}
 
+		if strings.HasPrefix(arg, "//LS") {
+			debug("Action:", "listServices")
+
+			p.DoList = true
+		}
+
+		if strings.HasPrefix(arg, "//TD") {
+			debug("Action:", "dumpService")
+
+			p.DoDump = true
+
+			p.DisplayName, i = argValue(arg, i)
+
+			err := p.loadConfig(true)
+			if checkError(err) {
+				return err
+			}
+		}
+
+		if strings.HasPrefix(arg, "//QS") {
+			debug("Action:", "queryService")
+
+			p.DoQuery = true
+
+			p.DisplayName, i = argValue(arg, i)
+
+			err := p.loadConfig(false)
+			if checkError(err) {
+				return err
+			}
+		}
+
+		if strings.HasPrefix(arg, "//HS") {
+			debug("Action:", "healthService")
+
+			p.DoHealth = true
+
+			p.DisplayName, i = argValue(arg, i)
+
+			err := p.loadConfig(true)
+			if checkError(err) {
+				return err
+			}
+		}
+
 		if strings.HasPrefix(arg, "--Description") {
 			p.Description, i = argValue(arg, i)
 		}
@@ -241,7 +426,7 @@ func (p *Prunsrv) scanArgs() error {
 			p.StartPath, i = argValue(arg, i)
 		}
 
-		if strings.HasPrefix(arg, "--Startup") {
+		if strings.HasPrefix(arg, "--Startup") || strings.HasPrefix(arg, "--startup") {
 			p.Startup, i = argValue(arg, i)
 		}
 
@@ -249,22 +434,34 @@ func (p *Prunsrv) scanArgs() error {
 			p.JavaHome, i = argValue(arg, i)
 		}
 
+		if strings.HasPrefix(arg, "--JavaVersion") {
+			p.JavaVersion, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--JavaVendor") {
+			p.JavaVendor, i = argValue(arg, i)
+		}
+
 		if strings.HasPrefix(arg, "--Classpath") {
 			p.Classpath, i = argValue(arg, i)
 		}
 
-		if strings.Contains(arg, "JvmOptions") {
-			var value string
+		if strings.Contains(arg, "JvmOptions9") {
+			p.JvmOptions9, i = argValues(p.JvmOptions9, arg, i)
+		} else if strings.Contains(arg, "JvmOptions") {
+			p.JvmOptions, i = argValues(p.JvmOptions, arg, i)
+		}
 
-			value, i = argValue(arg, i)
+		if strings.HasPrefix(arg, "--Environment") || strings.HasPrefix(arg, "++Environment") {
+			p.Environment, i = argValues(p.Environment, arg, i)
+		}
 
-			values := strings.Split(value, ";")
+		if strings.HasPrefix(arg, "--EnvInherit") {
+			p.EnvInherit, i = argValue(arg, i)
+		}
 
-			if strings.HasPrefix(arg, "++") {
-				p.JvmOptions = append(p.JvmOptions, values...)
-			} else {
-				p.JvmOptions = values
-			}
+		if strings.HasPrefix(arg, "--EnvAllowlist") || strings.HasPrefix(arg, "++EnvAllowlist") {
+			p.EnvAllowlist, i = argValues(p.EnvAllowlist, arg, i)
 		}
 
 		if strings.HasPrefix(arg, "--JvmMx") {
@@ -279,6 +476,30 @@ func (p *Prunsrv) scanArgs() error {
 			p.JvmSs, i = argValue(arg, i)
 		}
 
+		if strings.HasPrefix(arg, "--StartMode") {
+			p.StartMode, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopMode") {
+			p.StopMode, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StartImage") {
+			p.StartImage, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopImage") {
+			p.StopImage, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StartParams") || strings.HasPrefix(arg, "++StartParams") {
+			p.StartParams, i = argValues(p.StartParams, arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopParams") || strings.HasPrefix(arg, "++StopParams") {
+			p.StopParams, i = argValues(p.StopParams, arg, i)
+		}
+
 		if strings.HasPrefix(arg, "--StartClass") {
 			p.StartClass, i = argValue(arg, i)
 		}
@@ -295,10 +516,118 @@ func (p *Prunsrv) scanArgs() error {
 			p.StopMethod, i = argValue(arg, i)
 		}
 
+		if strings.HasPrefix(arg, "--ReloadClass") {
+			p.ReloadClass, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--ReloadMethod") {
+			p.ReloadMethod, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--ReloadSignal") {
+			p.ReloadSignal, i = argValue(arg, i)
+		}
+
 		if strings.HasPrefix(arg, "--StopTimeout") {
 			p.StopTimeout, i = argValue(arg, i)
 		}
 
+		if strings.HasPrefix(arg, "--StartReadiness") {
+			p.StartReadiness, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StartTimeout") {
+			p.StartTimeout, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopSequence") {
+			p.StopSequence, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopPort") {
+			p.StopPort, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopHost") {
+			p.StopHost, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopCommand") {
+			p.StopCommand, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopStdinText") {
+			p.StopStdinText, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopUrl") {
+			p.StopUrl, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopHttpMethod") {
+			p.StopHttpMethod, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StopStatus") {
+			p.StopStatus, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--HealthUrl") {
+			p.HealthUrl, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--HealthCheck") {
+			p.HealthCheck, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--HealthInterval") {
+			p.HealthInterval, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--HealthTimeout") {
+			p.HealthTimeout, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--HealthThreshold") {
+			p.HealthThreshold, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--HttpHeaders") || strings.HasPrefix(arg, "++HttpHeaders") {
+			p.HttpHeaders, i = argValues(p.HttpHeaders, arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--HttpInsecure") {
+			p.HttpInsecure, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--Cgroup") {
+			p.Cgroup, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--ControlGroup") {
+			p.ControlGroup, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--Output") || strings.HasPrefix(arg, "--output") {
+			p.Output, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--Wait") {
+			p.Wait, i = argValue(arg, i)
+		}
+
+		if arg == "--Direct" {
+			p.Direct = true
+		}
+
+		if arg == "--Elevate" {
+			p.Elevate = true
+		}
+
+		if strings.HasPrefix(arg, "--State") || strings.HasPrefix(arg, "--state") {
+			p.ListState, i = argValue(arg, i)
+		}
+
 		if strings.HasPrefix(arg, "--LogPath") {
 			p.LogPath, i = argValue(arg, i)
 		}
@@ -311,6 +640,30 @@ func (p *Prunsrv) scanArgs() error {
 			p.LogLevel, i = argValue(arg, i)
 		}
 
+		if strings.HasPrefix(arg, "--LogFormat") {
+			p.LogFormat, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--LogMaxSize") {
+			p.LogMaxSize, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--LogRotate") {
+			p.LogRotate, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--LogMaxFiles") {
+			p.LogMaxFiles, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--LogMaxAge") {
+			p.LogMaxAge, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--LogCompress") {
+			p.LogCompress, i = argValue(arg, i)
+		}
+
 		if strings.HasPrefix(arg, "--ServiceUser") {
 			p.ServiceUser, i = argValue(arg, i)
 		}
@@ -322,8 +675,48 @@ func (p *Prunsrv) scanArgs() error {
 		if strings.HasPrefix(arg, "--PidFile") {
 			p.PidFile, i = argValue(arg, i)
 		}
+
+		if strings.HasPrefix(arg, "--StdOutput") {
+			p.StdOutput, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--StdError") {
+			p.StdError, i = argValue(arg, i)
+		}
+
+		if arg == "--Restart" || strings.HasPrefix(arg, "--Restart=") {
+			p.Restart, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--RestartDelay") {
+			p.RestartDelay, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--RestartMaxDelay") {
+			p.RestartMaxDelay, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--RestartMaxCount") {
+			p.RestartMaxCount, i = argValue(arg, i)
+		}
+
+		if strings.HasPrefix(arg, "--RestartWindow") {
+			p.RestartWindow, i = argValue(arg, i)
+		}
+	}
+
+	// the services listed by //LS are created on their own
+	if p.DoList {
+		return nil
 	}
 
+	return p.newService()
+}
+
+// newService creates the OS service of the configuration
+func (p *Prunsrv) newService() error {
+	var err error
+
 	p.ServiceConfig.Name = p.DisplayName
 	p.ServiceConfig.Arguments = []string{fmt.Sprintf("//RS//%s", p.DisplayName)}
 	p.ServiceConfig.Description = p.Description
@@ -350,6 +743,8 @@ func (p *Prunsrv) scanArgs() error {
 		options["StartType"] = "disabled"
 	}
 
+	options["SystemdScript"] = p.systemdUnit()
+
 	p.ServiceConfig.Option = options
 
 	p.Service, err = service.New(p, &p.ServiceConfig)
@@ -385,7 +780,48 @@ func resolvEnvParameter(txt string) (string, error) {
 	return txt, err
 }
 
-func (p *Prunsrv) exec(asStart bool) (*exec.Cmd, error) {
+func (p *Prunsrv) startMode() string {
+	if p.StartMode == "" {
+		return modeJava
+	}
+
+	return parseMode(p.StartMode)
+}
+
+func (p *Prunsrv) stopMode() string {
+	if p.StopMode == "" {
+		return p.startMode()
+	}
+
+	return parseMode(p.StopMode)
+}
+
+// parseMode returns the mode in lower case, the procrun "jvm" mode runs the JVM in "java" mode
+func parseMode(mode string) string {
+	mode = strings.ToLower(mode)
+
+	if mode == modeJvm {
+		jvmModeOnce.Do(func() {
+			warn(fmt.Sprintf("mode %q is not supported, will use mode %q instead", modeJvm, modeJava))
+		})
+
+		return modeJava
+	}
+
+	return mode
+}
+
+func (p *Prunsrv) hasStopCommand() bool {
+	return p.stopMode() != modeExe || p.StopImage != ""
+}
+
+// javaCommand returns the JVM command line which calls method of class with params
+func (p *Prunsrv) javaCommand(class string, method string, params []string) (string, []string, error) {
+	jr, err := p.resolveJavaRuntime()
+	if checkError(err) {
+		return "", nil, err
+	}
+
 	var args []string
 
 	if p.JvmMx != "" {
@@ -402,6 +838,14 @@ func (p *Prunsrv) exec(asStart bool) (*exec.Cmd, error) {
 		args = append(args, option)
 	}
 
+	if len(p.JvmOptions9) > 0 {
+		if jr.MajorVersion() >= 9 {
+			args = append(args, p.JvmOptions9...)
+		} else {
+			warn(fmt.Sprintf("JvmOptions9 ignored for Java version %q of %s", jr.Version, jr.Home))
+		}
+	}
+
 	if p.Classpath != "" {
 		if p.StartClass != "" {
 			args = append(args, "-cp")
@@ -412,97 +856,463 @@ func (p *Prunsrv) exec(asStart bool) (*exec.Cmd, error) {
 		args = append(args, p.Classpath)
 	}
 
+	args = append(args, class)
+	args = append(args, method)
+	args = append(args, params...)
+
+	return filepath.Join(jr.Home, "bin", javaExecutable()), args, nil
+}
+
+func (p *Prunsrv) javaArgs(asStart bool) (string, []string, error) {
 	if asStart {
-		args = append(args, p.StartClass)
-		args = append(args, p.StartMethod)
-	} else {
-		args = append(args, p.StopClass)
-		args = append(args, p.StopMethod)
+		return p.javaCommand(p.StartClass, p.StartMethod, p.StartParams)
+	}
+
+	return p.javaCommand(p.StopClass, p.StopMethod, p.StopParams)
+}
+
+func (p *Prunsrv) exeArgs(asStart bool) (string, []string, error) {
+	image := p.StartImage
+	params := p.StartParams
+
+	if !asStart {
+		image = p.StopImage
+		params = p.StopParams
+	}
+
+	if image == "" {
+		return "", nil, fmt.Errorf("missing image for mode %s", modeExe)
+	}
+
+	if !strings.ContainsRune(image, filepath.Separator) && !strings.ContainsRune(image, '/') {
+		path, err := exec.LookPath(image)
+		if checkError(err) {
+			return "", nil, err
+		}
+
+		image = path
+	}
+
+	return image, params, nil
+}
+
+func envName(env string) string {
+	p := strings.Index(env, "=")
+	if p == -1 {
+		return env
+	}
+
+	return env[:p]
+}
+
+func envNameEquals(name0 string, name1 string) bool {
+	if isWindowsOS() {
+		return strings.EqualFold(name0, name1)
+	}
+
+	return name0 == name1
+}
+
+func setEnv(env []string, e string) []string {
+	name := envName(e)
+
+	for i := 0; i < len(env); i++ {
+		if envNameEquals(envName(env[i]), name) {
+			env = append(env[:i], env[i+1:]...)
+			i--
+		}
+	}
+
+	return append(env, e)
+}
+
+func (p *Prunsrv) environment() ([]string, error) {
+	// an empty but non-nil environment, exec.Cmd inherits the whole environment on nil
+	env := []string{}
+
+	switch strings.ToLower(p.EnvInherit) {
+	case "", envInheritAll:
+		env = os.Environ()
+	case envInheritNone:
+	case envInheritAllowlist:
+		allowlist := p.EnvAllowlist
+		if len(allowlist) == 0 {
+			allowlist = defaultEnvAllowlist
+		}
+
+		for _, e := range os.Environ() {
+			for _, name := range allowlist {
+				if envNameEquals(envName(e), name) {
+					env = append(env, e)
+
+					break
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown environment inheritance: %s", p.EnvInherit)
+	}
+
+	userEnv, err := p.serviceUserEnv()
+	if checkError(err) {
+		return nil, err
+	}
+
+	for _, e := range userEnv {
+		env = setEnv(env, e)
+	}
+
+	for _, e := range p.Environment {
+		if !strings.Contains(e, "=") {
+			return nil, fmt.Errorf("invalid environment variable, expected KEY=VALUE: %s", e)
+		}
+
+		e, err := resolvEnvParameter(e)
+		if checkError(err) {
+			return nil, err
+		}
+
+		env = setEnv(env, e)
+	}
+
+	debug("environment:", env)
+
+	return env, nil
+}
+
+func (p *Prunsrv) exec(asStart bool) (*exec.Cmd, error) {
+	var path string
+	var args []string
+	var err error
+
+	mode := p.startMode()
+	if !asStart {
+		mode = p.stopMode()
+	}
+
+	switch mode {
+	case modeJava:
+		path, args, err = p.javaArgs(asStart)
+		if checkError(err) {
+			return nil, err
+		}
+	case modeExe:
+		path, args, err = p.exeArgs(asStart)
+		if checkError(err) {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode: %s", mode)
+	}
+
+	return p.execPath(path, args, asStart)
+}
+
+// execPath starts path with args in the environment of the service, asStart starts the service process itself
+func (p *Prunsrv) execPath(path string, args []string, asStart bool) (*exec.Cmd, error) {
+	env, err := p.environment()
+	if checkError(err) {
+		return nil, err
 	}
 
 	cmd := &exec.Cmd{
-		Path: filepath.Join(p.JavaHome, "bin", javaExecutable()),
-		Args: args,
-		Env:  nil,
+		Path: path,
+		Args: append([]string{path}, args...),
+		Env:  env,
 		Dir:  p.StartPath,
 	}
 
-	logfWriter := io.Discard
+	prepareProcess(cmd)
+
+	// only a supervised service process is bound to the lifetime of PRUNSRV, see runService
+	if asStart && p.isSupervised() {
+		setParentDeathSignal(cmd)
+	}
+
+	err = p.applyServiceUser(cmd)
+	if checkError(err) {
+		return nil, err
+	}
+
+	var stdoutFallback io.Writer
+	var stderrFallback io.Writer
+
 	if asStart && logf != nil {
-		logfWriter = logf
-		cmd.Stdout = MWriter(logfWriter, os.Stdout)
-		cmd.Stderr = MWriter(logfWriter, os.Stderr)
+		stdoutFallback = MWriter(logf, os.Stdout)
+		stderrFallback = MWriter(logf, os.Stderr)
+	}
+
+	cmd.Stdout, err = p.stdRedirect(p.StdOutput, "stdout", os.Stdout, stdoutFallback)
+	if checkError(err) {
+		return nil, err
+	}
+
+	cmd.Stderr, err = p.stdRedirect(p.StdError, "stderr", os.Stderr, stderrFallback)
+	if checkError(err) {
+		return nil, err
 	}
 
-	debug("execCmd:", strings.Join(surroundWidth(append([]string{cmd.Path}, cmd.Args...), "\""), " "))
+	var recordWriters []*RecordWriter
+
+	if logFormat == logFormatJson {
+		if cmd.Stdout != nil {
+			rw := NewRecordWriter(cmd.Stdout, "stdout")
+			recordWriters = append(recordWriters, rw)
+			cmd.Stdout = rw
+		}
+
+		if cmd.Stderr != nil {
+			rw := NewRecordWriter(cmd.Stderr, "stderr")
+			recordWriters = append(recordWriters, rw)
+			cmd.Stderr = rw
+		}
+	}
 
 	if asStart {
-		err := cmd.Start()
+		r, err := p.readiness()
 		if checkError(err) {
 			return nil, err
 		}
-	} else {
-		err := cmd.Run()
+
+		var matched chan struct{}
+
+		if r != nil && r.Mode == readinessLog {
+			rw := NewRegexWriter(regexp.MustCompile(r.Value))
+			matched = rw.matched
+
+			if cmd.Stdout != nil {
+				cmd.Stdout = MWriter(cmd.Stdout, rw)
+			} else {
+				cmd.Stdout = rw
+			}
+		}
+
+		p.Mu.Lock()
+		p.ReadyMatched = matched
+		p.Mu.Unlock()
+	}
+
+	var stdin io.WriteCloser
+
+	if asStart && p.stopMode() == modeStdin {
+		stdin, err = cmd.StdinPipe()
+		if checkError(err) {
+			return nil, err
+		}
+	}
+
+	var cgroup io.Closer
+
+	if asStart && p.useCgroup() {
+		cgroup, err = p.cgroupPrepare(cmd)
 		if checkError(err) {
 			return nil, err
 		}
 	}
 
+	debug("execCmd:", strings.Join(surroundWidth(cmd.Args, "\""), " "))
+
+	err = cmd.Start()
+
+	if cgroup != nil {
+		checkError(cgroup.Close())
+	}
+
+	if checkError(err) {
+		return nil, err
+	}
+
+	if asStart {
+		p.Mu.Lock()
+		p.StartStdin = stdin
+		p.Mu.Unlock()
+	}
+
+	for _, rw := range recordWriters {
+		rw.SetPid(cmd.Process.Pid)
+	}
+
+	if len(recordWriters) > 0 {
+		p.Mu.Lock()
+		if p.RecordWriters == nil {
+			p.RecordWriters = make(map[int][]*RecordWriter)
+		}
+		p.RecordWriters[cmd.Process.Pid] = recordWriters
+		p.Mu.Unlock()
+	}
+
 	return cmd, nil
 }
 
-func (p *Prunsrv) Start(s service.Service) error {
-	debug("Start")
+// waitCmd waits for cmd to terminate and writes the last line of its output which has no newline
+func (p *Prunsrv) waitCmd(cmd *exec.Cmd) error {
+	err := cmd.Wait()
 
-	go func() {
-		checkError(p.startService())
-	}()
+	p.Mu.Lock()
+	recordWriters := p.RecordWriters[cmd.Process.Pid]
+	delete(p.RecordWriters, cmd.Process.Pid)
+	p.Mu.Unlock()
 
-	return nil
+	for _, rw := range recordWriters {
+		checkError(rw.Close())
+	}
+
+	return err
 }
 
-func (p *Prunsrv) Stop(s service.Service) error {
-	debug("Stop")
+func (p *Prunsrv) stdRedirect(value string, name string, console *os.File, fallback io.Writer) (io.Writer, error) {
+	var filename string
+	var dated bool
+
+	switch strings.ToLower(value) {
+	case "":
+		return fallback, nil
+	case stdInherit:
+		return console, nil
+	case stdAuto:
+		if p.LogPath == "" {
+			return nil, fmt.Errorf("missing LogPath for %s=%s", name, value)
+		}
 
-	timeout, err := strconv.Atoi(p.StopTimeout)
+		filename = filepath.Join(p.LogPath, fmt.Sprintf("%s-%s%s", p.DisplayName, name, logExt))
+		dated = true
+	default:
+		filename = value
+	}
+
+	debug("stdRedirect:", name, filename)
+
+	// the service process, the stop command and the reload command may be started concurrently
+	p.Mu.Lock()
+	defer p.Mu.Unlock()
+
+	w, ok := p.LogWriters[filename]
+	if ok {
+		return w, nil
+	}
+
+	options, err := p.rotateOptions()
 	if checkError(err) {
-		timeout = 60 * 60
+		return nil, err
 	}
 
-	err = p.stopService()
+	w, err = NewRotateWriter(filename, dated, options)
+	if checkError(err) {
+		return nil, err
+	}
+
+	if p.LogWriters == nil {
+		p.LogWriters = make(map[string]*RotateWriter)
+	}
+
+	p.LogWriters[filename] = w
+
+	return w, nil
+}
+
+func (p *Prunsrv) Start(s service.Service) error {
+	debug("Start")
+
+	startedCh := make(chan error, 1)
+
+	p.StopCh = make(chan struct{})
+	p.DoneCh = make(chan struct{})
+	p.StartedCh = startedCh
+	p.ResumeCh = make(chan struct{}, 1)
+
+	go p.supervise()
+
+	err := <-startedCh
 	if checkError(err) {
 		return err
 	}
 
-	timeoutDuration := time.Duration(min(timeout, 60*60)) * time.Second
-	timeoutCh := time.NewTimer(timeoutDuration)
-	waitCh := make(chan struct{})
+	// the service process is supervised without the control socket, the CLI commands then use the OS service manager
+	err = p.listenControl()
+	if err != nil {
+		warn(err)
+	}
 
-	go func() {
-		checkError(p.StartCmd.Wait())
+	// systemd runs the service with "Type=notify" and waits for READY=1
+	checkError(sdNotify("READY=1"))
 
-		waitCh <- struct{}{}
-	}()
+	return nil
+}
+
+func (p *Prunsrv) Stop(s service.Service) error {
+	debug("Stop")
 
-	stopped := false
-	for !stopped {
+	p.closeControl()
+
+	checkError(sdNotify("STOPPING=1"))
+
+	// a service process started by supervise after the stop request is killed by startService
+	p.Mu.Lock()
+	p.requestStop()
+	cmd := p.StartCmd
+	exitCh := p.ExitCh
+	p.Mu.Unlock()
+
+	running := cmd != nil && cmd.Process != nil
+	if running {
+		// the service process may have terminated already while supervise waits for its restart
 		select {
-		case <-waitCh:
-			stopped = true
-		case <-timeoutCh.C:
-			checkError(fmt.Errorf("process %d did not stop within %v, will now kill it", p.StartCmd.Process.Pid, timeoutDuration))
-			checkError(killProcess(p.StartCmd.Process.Pid))
-			stopped = true
+		case <-exitCh:
+			running = false
+		default:
 		}
 	}
 
-	if !timeoutCh.Stop() {
-		<-timeoutCh.C
+	if !running {
+		debug("no service process running")
+
+		p.awaitSupervise()
+
+		return nil
+	}
+
+	err := p.stopProcess(cmd.Process.Pid, exitCh)
+	if err != nil {
+		p.killProcessTree(cmd.Process.Pid)
+
+		// the service is only reported as stopped if no process of the process tree is left
+		treeErr := p.awaitProcessTree(cmd.Process.Pid, 5*time.Second)
+		if treeErr != nil {
+			err = treeErr
+		}
+	}
+
+	p.awaitSupervise()
+
+	p.recordExit(exitCode(cmd, nil), false)
+
+	p.removePidFile()
+
+	if p.useCgroup() {
+		p.cgroupRemove()
+	}
+
+	if checkError(err) {
+		return err
 	}
 
 	return nil
 }
 
+func appendListArgs(args []string, name string, values []string) []string {
+	for i := 0; i < len(values); i++ {
+		var prefix string
+		if i == 0 {
+			prefix = "--"
+		} else {
+			prefix = "++"
+		}
+		args = append(args, fmt.Sprintf("%s%s=%s", prefix, name, values[i]))
+	}
+
+	return args
+}
+
 func (p *Prunsrv) printService() error {
 	debug("printService")
 
@@ -514,40 +1324,91 @@ func (p *Prunsrv) printService() error {
 	args = append(args, fmt.Sprintf("%s=%s", "--StartPath", p.StartPath))
 	args = append(args, fmt.Sprintf("%s=%s", "--Startup", p.Startup))
 	args = append(args, fmt.Sprintf("%s=%s", "--JavaHome", p.JavaHome))
-	for i := 0; i < len(p.JvmOptions); i++ {
-		var prefix string
-		if i == 0 {
-			prefix = "--"
-		} else {
-			prefix = "++"
-		}
-		args = append(args, fmt.Sprintf("%s%s=%s", prefix, "JvmOptions", p.JvmOptions[i]))
-	}
+	args = append(args, fmt.Sprintf("%s=%s", "--JavaVersion", p.JavaVersion))
+	args = append(args, fmt.Sprintf("%s=%s", "--JavaVendor", p.JavaVendor))
+	args = appendListArgs(args, "JvmOptions", p.JvmOptions)
+	args = appendListArgs(args, "JvmOptions9", p.JvmOptions9)
+	args = appendListArgs(args, "Environment", p.Environment)
+	args = append(args, fmt.Sprintf("%s=%s", "--EnvInherit", p.EnvInherit))
+	args = appendListArgs(args, "EnvAllowlist", p.EnvAllowlist)
 	args = append(args, fmt.Sprintf("%s=%s", "--Classpath", p.Classpath))
 	args = append(args, fmt.Sprintf("%s=%s", "--JvmMx", p.JvmMx))
 	args = append(args, fmt.Sprintf("%s=%s", "--JvmMs", p.JvmMs))
 	args = append(args, fmt.Sprintf("%s=%s", "--JvmSs", p.JvmSs))
+	args = append(args, fmt.Sprintf("%s=%s", "--StartMode", p.StartMode))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopMode", p.StopMode))
+	args = append(args, fmt.Sprintf("%s=%s", "--StartImage", p.StartImage))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopImage", p.StopImage))
+	args = appendListArgs(args, "StartParams", p.StartParams)
+	args = appendListArgs(args, "StopParams", p.StopParams)
 	args = append(args, fmt.Sprintf("%s=%s", "--StartClass", p.StartClass))
 	args = append(args, fmt.Sprintf("%s=%s", "--StopClass", p.StopClass))
 	args = append(args, fmt.Sprintf("%s=%s", "--StartMethod", p.StartMethod))
 	args = append(args, fmt.Sprintf("%s=%s", "--StopMethod", p.StopMethod))
+	args = append(args, fmt.Sprintf("%s=%s", "--ReloadClass", p.ReloadClass))
+	args = append(args, fmt.Sprintf("%s=%s", "--ReloadMethod", p.ReloadMethod))
+	args = append(args, fmt.Sprintf("%s=%s", "--ReloadSignal", p.ReloadSignal))
 	args = append(args, fmt.Sprintf("%s=%s", "--StopTimeout", p.StopTimeout))
+	args = append(args, fmt.Sprintf("%s=%s", "--StartReadiness", p.StartReadiness))
+	args = append(args, fmt.Sprintf("%s=%s", "--StartTimeout", p.StartTimeout))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopSequence", p.StopSequence))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopPort", p.StopPort))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopHost", p.StopHost))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopCommand", p.StopCommand))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopStdinText", p.StopStdinText))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopUrl", p.StopUrl))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopHttpMethod", p.StopHttpMethod))
+	args = append(args, fmt.Sprintf("%s=%s", "--StopStatus", p.StopStatus))
+	args = append(args, fmt.Sprintf("%s=%s", "--HealthUrl", p.HealthUrl))
+	args = append(args, fmt.Sprintf("%s=%s", "--HealthCheck", p.HealthCheck))
+	args = append(args, fmt.Sprintf("%s=%s", "--HealthInterval", p.HealthInterval))
+	args = append(args, fmt.Sprintf("%s=%s", "--HealthTimeout", p.HealthTimeout))
+	args = append(args, fmt.Sprintf("%s=%s", "--HealthThreshold", p.HealthThreshold))
+	args = appendListArgs(args, "HttpHeaders", p.HttpHeaders)
+	args = append(args, fmt.Sprintf("%s=%s", "--HttpInsecure", p.HttpInsecure))
+	args = append(args, fmt.Sprintf("%s=%s", "--Cgroup", p.Cgroup))
+	args = append(args, fmt.Sprintf("%s=%s", "--ControlGroup", p.ControlGroup))
 	args = append(args, fmt.Sprintf("%s=%s", "--LogPath", p.LogPath))
 	args = append(args, fmt.Sprintf("%s=%s", "--LogLevel", p.LogLevel))
 	args = append(args, fmt.Sprintf("%s=%s", "--LogPrefix", p.LogPrefix))
+	args = append(args, fmt.Sprintf("%s=%s", "--LogFormat", p.LogFormat))
+	args = append(args, fmt.Sprintf("%s=%s", "--LogMaxSize", p.LogMaxSize))
+	args = append(args, fmt.Sprintf("%s=%s", "--LogRotate", p.LogRotate))
+	args = append(args, fmt.Sprintf("%s=%s", "--LogMaxFiles", p.LogMaxFiles))
+	args = append(args, fmt.Sprintf("%s=%s", "--LogMaxAge", p.LogMaxAge))
+	args = append(args, fmt.Sprintf("%s=%s", "--LogCompress", p.LogCompress))
 	args = append(args, fmt.Sprintf("%s=%s", "--ServiceUser", p.ServiceUser))
 	args = append(args, fmt.Sprintf("%s=%s", "--ServicePassword", p.ServicePassword))
 	args = append(args, fmt.Sprintf("%s=%s", "--PidFile", p.PidFile))
+	args = append(args, fmt.Sprintf("%s=%s", "--StdOutput", p.StdOutput))
+	args = append(args, fmt.Sprintf("%s=%s", "--StdError", p.StdError))
+	args = append(args, fmt.Sprintf("%s=%s", "--Restart", p.Restart))
+	args = append(args, fmt.Sprintf("%s=%s", "--RestartDelay", p.RestartDelay))
+	args = append(args, fmt.Sprintf("%s=%s", "--RestartMaxDelay", p.RestartMaxDelay))
+	args = append(args, fmt.Sprintf("%s=%s", "--RestartMaxCount", p.RestartMaxCount))
+	args = append(args, fmt.Sprintf("%s=%s", "--RestartWindow", p.RestartWindow))
 
 	var argSep string
 	var lineSep string
+	var remark string
 
 	if isWindowsOS() {
 		argSep = "\""
 		lineSep = "^"
+		remark = "rem"
 	} else {
 		argSep = "'"
 		lineSep = "\\"
+		remark = "#"
+	}
+
+	if p.startMode() == modeJava {
+		jr, err := p.resolveJavaRuntime()
+		if err == nil {
+			fmt.Printf("%s resolved JavaHome: %s (version: %s, vendor: %s)\n", remark, jr.Home, jr.Version, jr.Vendor)
+		} else {
+			fmt.Printf("%s resolved JavaHome: %v\n", remark, err)
+		}
 	}
 
 	args = surroundWidth(args, argSep)
@@ -561,54 +1422,151 @@ func (p *Prunsrv) printService() error {
 	return nil
 }
 
+func (p *Prunsrv) pidFilename() string {
+	filename := p.PidFile
+	if !filepath.IsAbs(filename) {
+		filename = p.configFilename(configDir(), ".pid")
+	}
+
+	return filename
+}
+
+func (p *Prunsrv) removePidFile() {
+	if p.PidFile != "" {
+		checkError(os.Remove(p.pidFilename()))
+	}
+}
+
 func (p *Prunsrv) startService() error {
 	debug("startService")
 
-	var err error
-
-	p.StartCmd, err = p.exec(true)
+	cmd, err := p.exec(true)
 	if checkError(err) {
+		p.Mu.Lock()
+		p.StartCmd = nil
+		p.Mu.Unlock()
+
 		return err
 	}
 
+	p.Mu.Lock()
+	// Stop has already taken the service process to stop if it was requested meanwhile
+	stopping := p.isStopping()
+	if !stopping {
+		p.StartCmd = cmd
+		p.ExitCh = make(chan struct{})
+	}
+	p.Mu.Unlock()
+
+	if stopping {
+		warn(fmt.Sprintf("service is stopping, will now kill service process %d", cmd.Process.Pid))
+
+		p.killProcessTree(cmd.Process.Pid)
+		p.waitCmd(cmd)
+
+		return fmt.Errorf("service is stopping")
+	}
+
+	logPid.Store(int64(cmd.Process.Pid))
+
 	if p.PidFile != "" {
-		filename := p.PidFile
-		if !filepath.IsAbs(filename) {
-			filename = p.configFilename(configDir(), ".pid")
+		checkError(ioutil.WriteFile(p.pidFilename(), []byte(strconv.Itoa(cmd.Process.Pid)), os.ModePerm))
+	}
+
+	return nil
+}
+
+// stopServiceManaged stops the service by the OS service manager, a service which is not run
+// by the OS service manager (//TS) is stopped by its supervising PRUNSRV process
+func (p *Prunsrv) stopServiceManaged() error {
+	debug("stopServiceManaged")
+
+	if p.Direct {
+		return p.stopServiceDirect()
+	}
+
+	status, err := p.Service.Status()
+	if err != nil || status != service.StatusRunning {
+		response, err := p.control(controlStop)
+		if err == nil {
+			fmt.Println(response.Message)
+
+			return nil
 		}
 
-		checkError(ioutil.WriteFile(filename, []byte(strconv.Itoa(p.StartCmd.Process.Pid)), os.ModePerm))
+		if err != errNoSupervisor {
+			return err
+		}
 	}
 
-	return nil
+	info("stopping the service by the OS service manager")
+
+	err = service.Control(p.Service, "stop")
+	if checkError(err) {
+		return err
+	}
+
+	return p.awaitStatus(service.StatusStopped)
 }
 
-func (p *Prunsrv) stopService() error {
-	debug("stopService")
+// startServiceManaged starts the service by the OS service manager, a service process which
+// was stopped by //SS while its supervising PRUNSRV process is running is started by that process
+func (p *Prunsrv) startServiceManaged() error {
+	debug("startServiceManaged")
 
-	var err error
+	if p.Direct {
+		return p.startServiceDirect()
+	}
+
+	response, err := p.control(controlStart)
+	if err == nil {
+		fmt.Println(response.Message)
+
+		return nil
+	}
+
+	if err != errNoSupervisor {
+		return err
+	}
 
-	p.StopCmd, err = p.exec(false)
+	info("starting the service by the OS service manager")
+
+	err = service.Control(p.Service, "start")
 	if checkError(err) {
 		return err
 	}
 
-	if p.PidFile != "" {
-		filename := p.PidFile
-		if !filepath.IsAbs(filename) {
-			filename = p.configFilename(configDir(), ".pid")
-		}
+	err = p.awaitStatus(service.StatusRunning)
+	if checkError(err) {
+		return err
+	}
+
+	// not every OS service manager waits for the readiness, the supervising PRUNSRV process does
+	return p.awaitSupervisor()
+}
 
-		checkError(os.Remove(filename))
+// stopServiceDirect executes the stop command without the supervising PRUNSRV process
+func (p *Prunsrv) stopServiceDirect() error {
+	debug("stopServiceDirect")
+
+	if p.hasStopCommand() {
+		err := p.runStopCommand(p.stopTimeout())
+		if checkError(err) {
+			return err
+		}
+	} else {
+		warn("no stop command defined")
 	}
 
+	p.removePidFile()
+
 	return nil
 }
 
 func (p *Prunsrv) testService() error {
 	debug("testService")
 
-	err := p.startService()
+	err := p.Start(p.Service)
 	if checkError(err) {
 		return err
 	}
@@ -618,7 +1576,7 @@ func (p *Prunsrv) testService() error {
 
 	<-ctrlC
 
-	err = p.stopService()
+	err = p.Stop(p.Service)
 	if checkError(err) {
 		return err
 	}
@@ -629,9 +1587,12 @@ func (p *Prunsrv) testService() error {
 func (p *Prunsrv) installService() error {
 	debug("installService")
 
-	checkAdmin()
+	err := checkAdmin(p.Elevate)
+	if checkError(err) {
+		return err
+	}
 
-	err := p.saveConfig()
+	err = p.saveConfig()
 	if checkError(err) {
 		return err
 	}
@@ -655,9 +1616,12 @@ func (p *Prunsrv) installService() error {
 func (p *Prunsrv) updateService() error {
 	debug("installService")
 
-	checkAdmin()
+	err := checkAdmin(p.Elevate)
+	if checkError(err) {
+		return err
+	}
 
-	err := p.saveConfig()
+	err = p.saveConfig()
 	if checkError(err) {
 		return err
 	}
@@ -675,9 +1639,12 @@ func (p *Prunsrv) updateService() error {
 func (p *Prunsrv) uninstallService() error {
 	debug("uninstallService")
 
-	checkAdmin()
+	err := checkAdmin(p.Elevate)
+	if checkError(err) {
+		return err
+	}
 
-	err := p.deleteConfig()
+	err = p.deleteConfig()
 	checkError(err)
 
 	service.Control(p.Service, "stop")
@@ -784,13 +1751,14 @@ func (p *Prunsrv) deleteConfig() error {
 }
 
 func run() error {
-	b, _ := getFlag("--debug")
-	isDebug = !service.Interactive() || b
-
-	banner()
+	isDebug, _ := getFlag("--debug")
+	if isDebug {
+		logLevel = levelDebug
+	}
 
-	b, _ = getFlag("//?")
+	b, _ := getFlag("//?")
 	if len(os.Args) < 2 || b {
+		banner()
 		usage()
 
 		return nil
@@ -805,20 +1773,43 @@ func run() error {
 		return err
 	}
 
-	if p.DisplayName == "" {
+	if p.DisplayName == "" && !p.DoList {
 		return fmt.Errorf("missing service name")
 	}
 
-	if p.LogPath != "" && p.LogLevel == "debug" {
-		var err error
+	level, err := parseLogLevel(p.LogLevel)
+	if checkError(err) {
+		return err
+	}
+
+	logFormat, err = parseLogFormat(p.LogFormat)
+	if checkError(err) {
+		return err
+	}
+
+	// the banner must neither precede JSON output nor mix with the JSON log records of the service process
+	if !isJsonOutput() && logFormat != logFormatJson {
+		banner()
+	}
+
+	logService = p.DisplayName
 
-		logf, err = createLogFile(p.configFilename(p.LogPath, ".log"))
+	if !isDebug {
+		logLevel = level
+	}
+
+	// only the service itself writes the log file, other actions may lack the permission to write it
+	if p.LogPath != "" && (p.DoService || p.DoTest) {
+		options, err := p.rotateOptions()
 		if checkError(err) {
 			return err
 		}
-	}
 
-	initLogs = nil
+		logf, err = createLogFile(p.configFilename(p.LogPath, logExt), options)
+		if checkError(err) {
+			return err
+		}
+	}
 
 	defer func() {
 		if logf != nil {
@@ -830,9 +1821,21 @@ func run() error {
 		p.LogPrefix = title()
 	}
 
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-	log.SetOutput(MWriter(logf, os.Stderr))
-	log.SetPrefix(p.LogPrefix + " --- ")
+	if logf != nil {
+		log.SetOutput(MWriter(logf, os.Stderr))
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+
+	if logFormat == logFormatJson {
+		log.SetFlags(0)
+		log.SetPrefix("")
+	} else {
+		log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+		log.SetPrefix(p.LogPrefix + " --- ")
+	}
+
+	flushInitLogs()
 
 	debug("Service:", p.DisplayName)
 
@@ -842,9 +1845,9 @@ func run() error {
 	case p.DoTest:
 		return p.testService()
 	case p.DoStart:
-		return p.startService()
+		return p.startServiceManaged()
 	case p.DoStop:
-		return p.stopService()
+		return p.stopServiceManaged()
 	case p.DoInstall:
 		return p.installService()
 	case p.DoUpdate:
@@ -853,11 +1856,21 @@ func run() error {
 		return p.uninstallService()
 	case p.DoPrint:
 		return p.printService()
+	case p.DoHealth:
+		return p.healthService()
+	case p.DoRestart:
+		return p.restartService()
+	case p.DoReload:
+		return p.reloadService()
+	case p.DoDump:
+		return p.dumpService()
+	case p.DoQuery:
+		return p.queryService()
+	case p.DoList:
+		return p.listServices()
 	default:
 		return fmt.Errorf("unknown action: %s", os.Args[1])
 	}
-
-	return nil
 }
 
 func main() {
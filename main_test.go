@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvironment(t *testing.T) {
+	t.Setenv("PRUNSRV_TEST_INHERITED", "inherited")
+	t.Setenv("PRUNSRV_TEST_OTHER", "other")
+
+	tests := []struct {
+		name        string
+		inherit     string
+		allowlist   []string
+		environment []string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:    "none",
+			inherit: envInheritNone,
+			want:    []string{},
+		},
+		{
+			name:        "none with environment",
+			inherit:     envInheritNone,
+			environment: []string{"A=1", "B=${PRUNSRV_TEST_INHERITED}", "A=2"},
+			want:        []string{"B=inherited", "A=2"},
+		},
+		{
+			name:      "allowlist without match",
+			inherit:   envInheritAllowlist,
+			allowlist: []string{"PRUNSRV_TEST_UNKNOWN"},
+			want:      []string{},
+		},
+		{
+			name:      "allowlist",
+			inherit:   envInheritAllowlist,
+			allowlist: []string{"PRUNSRV_TEST_INHERITED"},
+			want:      []string{"PRUNSRV_TEST_INHERITED=inherited"},
+		},
+		{
+			name:        "invalid environment",
+			inherit:     envInheritNone,
+			environment: []string{"A"},
+			wantErr:     true,
+		},
+		{
+			name:    "unknown inheritance",
+			inherit: "some",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		p := &Prunsrv{
+			EnvInherit:   test.inherit,
+			EnvAllowlist: test.allowlist,
+			Environment:  test.environment,
+		}
+
+		got, err := p.environment()
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", test.name, err, test.wantErr)
+
+			continue
+		}
+
+		if test.wantErr {
+			continue
+		}
+
+		// a nil environment makes exec.Cmd inherit the whole environment
+		if got == nil {
+			t.Errorf("%s: environment is nil", test.name)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: environment = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEnvironmentInheritAll(t *testing.T) {
+	t.Setenv("PRUNSRV_TEST_INHERITED", "inherited")
+
+	p := &Prunsrv{
+		Environment: []string{"PRUNSRV_TEST_INHERITED=overridden"},
+	}
+
+	env, err := p.environment()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for _, e := range env {
+		if envName(e) == "PRUNSRV_TEST_INHERITED" {
+			n++
+
+			if e != "PRUNSRV_TEST_INHERITED=overridden" {
+				t.Errorf("environment contains %s, want overridden value", e)
+			}
+		}
+	}
+
+	if n != 1 {
+		t.Errorf("environment contains PRUNSRV_TEST_INHERITED %d times, want once", n)
+	}
+}
+
+func TestMode(t *testing.T) {
+	tests := []struct {
+		startMode string
+		stopMode  string
+		wantStart string
+		wantStop  string
+	}{
+		{"", "", modeJava, modeJava},
+		{"exe", "", modeExe, modeExe},
+		{"jvm", "", modeJava, modeJava},
+		{"Java", "JVM", modeJava, modeJava},
+		{"exe", "http", modeExe, modeHttp},
+	}
+
+	for _, test := range tests {
+		p := &Prunsrv{
+			StartMode: test.startMode,
+			StopMode:  test.stopMode,
+		}
+
+		if got := p.startMode(); got != test.wantStart {
+			t.Errorf("startMode(%q) = %q, want %q", test.startMode, got, test.wantStart)
+		}
+
+		if got := p.stopMode(); got != test.wantStop {
+			t.Errorf("stopMode(%q, %q) = %q, want %q", test.startMode, test.stopMode, got, test.wantStop)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+
+	// clockTicks is the USER_HZ of /proc/<pid>/stat, which is 100 on all common Linux platforms
+	clockTicks = 100
+)
+
+// setParentDeathSignal kills the process if the OS thread which started it terminates,
+// so the process must be started by a goroutine locked to its OS thread
+func setParentDeathSignal(cmd *exec.Cmd) {
+	sysProcAttr(cmd).Pdeathsig = syscall.SIGKILL
+}
+
+// sdNotify sends state to systemd if PRUNSRV is run by systemd with "Type=notify"
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	debug("sdNotify:", state)
+
+	// a socket in the abstract namespace starts with "@"
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+
+	return err
+}
+
+func cgroupAvailable() bool {
+	return fileExists(filepath.Join(cgroupRoot, "cgroup.controllers"))
+}
+
+// ownCgroup returns the cgroup v2 path of PRUNSRV itself
+func ownCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if checkError(err) {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "0::") {
+			return filepath.Join(cgroupRoot, strings.TrimPrefix(line, "0::")), nil
+		}
+	}
+
+	return "", fmt.Errorf("no cgroup v2 found for PRUNSRV")
+}
+
+func (p *Prunsrv) cgroupPath() (string, error) {
+	dir, err := ownCgroup()
+	if checkError(err) {
+		return "", err
+	}
+
+	return filepath.Join(dir, title()+"-"+p.DisplayName), nil
+}
+
+// cgroupPrepare starts the process directly in the cgroup of the service (Linux 5.7 or newer),
+// so no process forked by it before can escape, the returned cgroup must be closed after the start
+func (p *Prunsrv) cgroupPrepare(cmd *exec.Cmd) (io.Closer, error) {
+	if !cgroupAvailable() {
+		return nil, fmt.Errorf("cgroup v2 is not available")
+	}
+
+	path, err := p.cgroupPath()
+	if checkError(err) {
+		return nil, err
+	}
+
+	err = os.MkdirAll(path, os.ModePerm)
+	if checkError(err) {
+		return nil, err
+	}
+
+	debug("cgroupPrepare:", path)
+
+	f, err := os.Open(path)
+	if checkError(err) {
+		return nil, err
+	}
+
+	sysProcAttr(cmd).UseCgroupFD = true
+	sysProcAttr(cmd).CgroupFD = int(f.Fd())
+
+	return f, nil
+}
+
+func (p *Prunsrv) cgroupPids() []int {
+	path, err := p.cgroupPath()
+	if err != nil {
+		return nil
+	}
+
+	ba, err := os.ReadFile(filepath.Join(path, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+
+	for _, field := range strings.Fields(string(ba)) {
+		pid, err := strconv.Atoi(field)
+		if err == nil {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
+
+func (p *Prunsrv) cgroupKill() error {
+	path, err := p.cgroupPath()
+	if checkError(err) {
+		return err
+	}
+
+	if fileExists(filepath.Join(path, "cgroup.kill")) {
+		return os.WriteFile(filepath.Join(path, "cgroup.kill"), []byte("1"), os.ModePerm)
+	}
+
+	for _, pid := range p.cgroupPids() {
+		checkError(syscall.Kill(pid, syscall.SIGKILL))
+	}
+
+	return nil
+}
+
+func (p *Prunsrv) cgroupRemove() {
+	path, err := p.cgroupPath()
+	if err != nil || !fileExists(path) {
+		return
+	}
+
+	debug("cgroupRemove:", path)
+
+	checkError(os.Remove(path))
+}
+
+func bootTime() (time.Time, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 2 && fields[0] == "btime" {
+			seconds, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+
+			return time.Unix(seconds, 0), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("no boot time found")
+}
+
+// processInfo reads the start time, CPU time and resident memory of pid from /proc
+func processInfo(pid int) (*ProcessInfo, error) {
+	ba, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// the command name in parentheses may contain spaces, the fields start after it
+	stat := string(ba)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("invalid /proc/%d/stat", pid)
+	}
+
+	var ticks [3]int64
+	for i, index := range []int{11, 12, 19} {
+		ticks[i], err = strconv.ParseInt(fields[index], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	boot, err := bootTime()
+	if err != nil {
+		return nil, err
+	}
+
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProcessInfo{
+		Started: boot.Add(time.Duration(ticks[2]) * time.Second / clockTicks),
+		Cpu:     time.Duration(ticks[0]+ticks[1]) * time.Second / clockTicks,
+		Rss:     rss * int64(os.Getpagesize()),
+	}, nil
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// setParentDeathSignal does nothing, a parent death signal is only supported on Linux
+func setParentDeathSignal(cmd *exec.Cmd) {
+}
+
+// sdNotify does nothing, systemd is only available on Linux
+func sdNotify(state string) error {
+	return nil
+}
+
+func (p *Prunsrv) cgroupPrepare(cmd *exec.Cmd) (io.Closer, error) {
+	return nil, fmt.Errorf("cgroup v2 is only supported on Linux")
+}
+
+func (p *Prunsrv) cgroupPids() []int {
+	return nil
+}
+
+func (p *Prunsrv) cgroupKill() error {
+	return nil
+}
+
+func (p *Prunsrv) cgroupRemove() {
+}
+
+func processInfo(pid int) (*ProcessInfo, error) {
+	return nil, fmt.Errorf("process information is only supported on Linux")
+}
@@ -0,0 +1,129 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+func (p *Prunsrv) lookupServiceUser() (*user.User, error) {
+	if p.ServiceUser == "" {
+		return nil, nil
+	}
+
+	u, err := user.Lookup(p.ServiceUser)
+	if err != nil {
+		return nil, fmt.Errorf("unknown ServiceUser %s: %v", p.ServiceUser, err)
+	}
+
+	return u, nil
+}
+
+func (p *Prunsrv) serviceUserEnv() ([]string, error) {
+	u, err := p.lookupServiceUser()
+	if checkError(err) {
+		return nil, err
+	}
+
+	if u == nil {
+		return nil, nil
+	}
+
+	return []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+	}, nil
+}
+
+func sysProcAttr(cmd *exec.Cmd) *syscall.SysProcAttr {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	return cmd.SysProcAttr
+}
+
+func (p *Prunsrv) applyServiceUser(cmd *exec.Cmd) error {
+	u, err := p.lookupServiceUser()
+	if checkError(err) {
+		return err
+	}
+
+	if u == nil {
+		return nil
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if checkError(err) {
+		return err
+	}
+
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if checkError(err) {
+		return err
+	}
+
+	if int(uid) == os.Geteuid() {
+		debug("applyServiceUser: already running as", u.Username)
+
+		return nil
+	}
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("cannot run as ServiceUser %s without root privileges", u.Username)
+	}
+
+	groupIds, err := u.GroupIds()
+	if checkError(err) {
+		return err
+	}
+
+	var groups []uint32
+
+	for _, groupId := range groupIds {
+		g, err := strconv.ParseUint(groupId, 10, 32)
+		if checkError(err) {
+			return err
+		}
+
+		groups = append(groups, uint32(g))
+	}
+
+	debug("applyServiceUser:", u.Username, uid, gid, groups)
+
+	sysProcAttr(cmd).Credential = &syscall.Credential{
+		Uid:    uint32(uid),
+		Gid:    uint32(gid),
+		Groups: groups,
+	}
+
+	return nil
+}
+
+// prepareProcess starts the process in its own process group, so the whole
+// process tree can be signaled
+func prepareProcess(cmd *exec.Cmd) {
+	sysProcAttr(cmd).Setpgid = true
+}
+
+// signalProcess signals the process group of pid, or only pid if there is no such group
+func signalProcess(pid int, sig syscall.Signal) error {
+	debug("signalProcess:", pid, sig)
+
+	err := syscall.Kill(-pid, sig)
+	if err == syscall.ESRCH {
+		err = syscall.Kill(pid, sig)
+	}
+
+	return err
+}
+
+func processGroupAlive(pid int) bool {
+	return syscall.Kill(-pid, 0) == nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// serviceUserEnv returns no environment, the OS service manager already runs PRUNSRV as the ServiceUser
+func (p *Prunsrv) serviceUserEnv() ([]string, error) {
+	return nil, nil
+}
+
+// applyServiceUser does nothing, the OS service manager already runs PRUNSRV as the ServiceUser
+func (p *Prunsrv) applyServiceUser(cmd *exec.Cmd) error {
+	return nil
+}
+
+// prepareProcess does nothing, process groups are not supported on Windows
+func prepareProcess(cmd *exec.Cmd) {
+}
+
+func processGroupAlive(pid int) bool {
+	return findProcess(pid) != nil
+}
+
+func signalProcess(pid int, sig syscall.Signal) error {
+	debug("signalProcess:", pid, sig)
+
+	if sig != syscall.SIGKILL {
+		return fmt.Errorf("signal %v is not supported on Windows", sig)
+	}
+
+	process, err := os.FindProcess(pid)
+	if checkError(err) {
+		return err
+	}
+
+	return process.Kill()
+}
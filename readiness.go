@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	readinessTcp  = "tcp"
+	readinessHttp = "http"
+	readinessLog  = "log"
+	readinessFile = "file"
+)
+
+type Readiness struct {
+	Mode  string
+	Value string
+}
+
+func (r Readiness) String() string {
+	return fmt.Sprintf("%s:%s", r.Mode, r.Value)
+}
+
+func (p *Prunsrv) readiness() (*Readiness, error) {
+	s := strings.TrimSpace(p.StartReadiness)
+	if s == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		return &Readiness{Mode: readinessHttp, Value: s}, nil
+	}
+
+	pos := strings.Index(s, ":")
+	if pos == -1 {
+		return nil, fmt.Errorf("invalid StartReadiness, expected MODE:VALUE: %s", s)
+	}
+
+	r := &Readiness{
+		Mode:  strings.ToLower(s[:pos]),
+		Value: s[pos+1:],
+	}
+
+	switch r.Mode {
+	case readinessTcp:
+		if !strings.Contains(r.Value, ":") {
+			r.Value = net.JoinHostPort("localhost", r.Value)
+		}
+	case readinessHttp, readinessFile:
+	case readinessLog:
+		_, err := regexp.Compile(r.Value)
+		if checkError(err) {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown StartReadiness mode: %s", r.Mode)
+	}
+
+	return r, nil
+}
+
+func (p *Prunsrv) startTimeout() time.Duration {
+	return parseDuration(p.StartTimeout, time.Minute)
+}
+
+// RegexWriter signals when a line of the written output matches the regex
+type RegexWriter struct {
+	mu      sync.Mutex
+	regex   *regexp.Regexp
+	buf     bytes.Buffer
+	matched chan struct{}
+	once    sync.Once
+}
+
+func NewRegexWriter(regex *regexp.Regexp) *RegexWriter {
+	return &RegexWriter{
+		regex:   regex,
+		matched: make(chan struct{}),
+	}
+}
+
+func (rw *RegexWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.buf.Write(p)
+
+	for {
+		line, err := rw.buf.ReadString('\n')
+		if err != nil {
+			rw.buf.Reset()
+			rw.buf.WriteString(line)
+
+			break
+		}
+
+		if rw.regex.MatchString(line) {
+			rw.once.Do(func() {
+				close(rw.matched)
+			})
+		}
+	}
+
+	return len(p), nil
+}
+
+func (p *Prunsrv) isReady(r *Readiness, matched chan struct{}) bool {
+	switch r.Mode {
+	case readinessTcp:
+		conn, err := net.DialTimeout("tcp", r.Value, time.Second)
+		if err != nil {
+			return false
+		}
+
+		conn.Close()
+
+		return true
+	case readinessHttp:
+		return p.httpRequest(http.MethodGet, r.Value, "", time.Second*5) == nil
+	case readinessFile:
+		return fileExists(r.Value)
+	case readinessLog:
+		select {
+		case <-matched:
+			return true
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// awaitReadiness waits until the service process is ready, terminated or StartTimeout has elapsed
+func (p *Prunsrv) awaitReadiness(exitCh chan struct{}) error {
+	debug("awaitReadiness")
+
+	r, err := p.readiness()
+	if checkError(err) {
+		return err
+	}
+
+	if r == nil {
+		return nil
+	}
+
+	p.Mu.Lock()
+	matched := p.ReadyMatched
+	p.Mu.Unlock()
+
+	timeout := p.startTimeout()
+	started := time.Now()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	lastProgress := started
+
+	for {
+		if p.isReady(r, matched) {
+			info(fmt.Sprintf("service is ready (%v) after %v", r, time.Since(started).Round(time.Millisecond)))
+
+			return nil
+		}
+
+		select {
+		case <-exitCh:
+			return fmt.Errorf("service process terminated before being ready (%v)", r)
+		case <-ticker.C:
+		}
+
+		if time.Since(started) >= timeout {
+			return fmt.Errorf("service is not ready (%v) within %v", r, timeout)
+		}
+
+		if time.Since(lastProgress) >= 2*time.Second {
+			lastProgress = time.Now()
+
+			info(fmt.Sprintf("waiting for service to be ready (%v) %v/%v", r, time.Since(started).Round(time.Second), timeout))
+		}
+	}
+}
+
+// startServiceDirect starts the service process without the supervising PRUNSRV process and waits for its readiness
+func (p *Prunsrv) startServiceDirect() error {
+	debug("startServiceDirect")
+
+	err := p.startService()
+	if checkError(err) {
+		return err
+	}
+
+	p.Mu.Lock()
+	pid := p.StartCmd.Process.Pid
+	exitCh := p.ExitCh
+	p.Mu.Unlock()
+
+	go func() {
+		checkError(p.waitService())
+	}()
+
+	err = p.awaitReadiness(exitCh)
+	if checkError(err) {
+		if p.stopProcess(pid, exitCh) != nil {
+			p.killProcessTree(pid)
+		}
+
+		return err
+	}
+
+	return nil
+}
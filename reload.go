@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kardianos/service"
+)
+
+func (p *Prunsrv) reloadSignal() (syscall.Signal, error) {
+	name := strings.ToUpper(strings.TrimSpace(p.ReloadSignal))
+	if name == "" {
+		return syscall.SIGHUP, nil
+	}
+
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	// these signals cannot be handled by the service process, so they would never reload it
+	if name == "SIGKILL" || name == "SIGSTOP" {
+		return 0, fmt.Errorf("invalid reload signal: %s", p.ReloadSignal)
+	}
+
+	sig, ok := stopSignals[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown reload signal: %s", p.ReloadSignal)
+	}
+
+	return sig, nil
+}
+
+func (p *Prunsrv) reloadMethod() string {
+	if p.ReloadMethod == "" {
+		return "reload"
+	}
+
+	return p.ReloadMethod
+}
+
+// runReloadCommand runs the JVM which calls ReloadMethod of ReloadClass
+func (p *Prunsrv) runReloadCommand(timeout time.Duration) error {
+	debug("runReloadCommand")
+
+	path, args, err := p.javaCommand(p.ReloadClass, p.reloadMethod(), nil)
+	if checkError(err) {
+		return err
+	}
+
+	cmd, err := p.execPath(path, args, false)
+	if checkError(err) {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- p.waitCmd(cmd)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errCh:
+		if checkError(err) {
+			return err
+		}
+
+		return nil
+	case <-timer.C:
+		checkError(killProcess(cmd.Process.Pid))
+
+		return fmt.Errorf("reload command did not finish within %v", timeout)
+	}
+}
+
+// reloadProcess makes the service process reload its configuration by the ReloadClass or the ReloadSignal
+func (p *Prunsrv) reloadProcess(pid int) error {
+	debug("reloadProcess:", pid)
+
+	if p.ReloadClass != "" {
+		return p.runReloadCommand(p.stopTimeout())
+	}
+
+	sig, err := p.reloadSignal()
+	if checkError(err) {
+		return err
+	}
+
+	process := findProcess(pid)
+	if process == nil {
+		return fmt.Errorf("service process %d is not running", pid)
+	}
+
+	info(fmt.Sprintf("send %v to service process %d", sig, pid))
+
+	return process.Signal(sig)
+}
+
+// awaitReloaded waits for the readiness of the reloaded service process,
+// a "log" readiness cannot be checked again as the matching line was already written
+func (p *Prunsrv) awaitReloaded(exitCh chan struct{}) error {
+	r, err := p.readiness()
+	if checkError(err) {
+		return err
+	}
+
+	if r == nil || r.Mode == readinessLog {
+		return nil
+	}
+
+	return p.awaitReadiness(exitCh)
+}
+
+func (p *Prunsrv) controlReload() (string, error) {
+	p.Mu.Lock()
+	hold := p.Hold
+	cmd := p.StartCmd
+	exitCh := p.ExitCh
+	p.Mu.Unlock()
+
+	if hold || cmd == nil || cmd.Process == nil {
+		return "", fmt.Errorf("service process is not running")
+	}
+
+	err := p.reloadProcess(cmd.Process.Pid)
+	if checkError(err) {
+		return "", err
+	}
+
+	err = p.awaitReloaded(exitCh)
+	if checkError(err) {
+		return "", err
+	}
+
+	return fmt.Sprintf("service process %d reloaded", cmd.Process.Pid), nil
+}
+
+// awaitSupervisor waits until the supervising PRUNSRV process reports the service process as running,
+// it listens on the control socket only after the service process is ready
+func (p *Prunsrv) awaitSupervisor() error {
+	debug("awaitSupervisor")
+
+	timeout := parseDuration(p.Wait, p.controlTimeout())
+	if timeout <= 0 {
+		return nil
+	}
+
+	started := time.Now()
+
+	for {
+		response, err := p.control(controlStatus)
+		if err == nil && response.Status != nil && response.Status.Status == statusRunning {
+			return nil
+		}
+
+		if time.Since(started) >= timeout {
+			return fmt.Errorf("service %s is not ready within %v", p.DisplayName, timeout)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// restartService restarts the service process by the supervising PRUNSRV process, or the
+// whole service by the OS service manager if there is no supervising process
+func (p *Prunsrv) restartService() error {
+	debug("restartService")
+
+	if p.Direct {
+		err := p.stopServiceDirect()
+		if checkError(err) {
+			return err
+		}
+
+		return p.startServiceDirect()
+	}
+
+	response, err := p.control(controlRestart)
+	if err == nil {
+		fmt.Println(response.Message)
+
+		return nil
+	}
+
+	if err != errNoSupervisor {
+		return err
+	}
+
+	info("restarting the service by the OS service manager")
+
+	err = service.Control(p.Service, "restart")
+	if checkError(err) {
+		return err
+	}
+
+	err = p.awaitStatus(service.StatusRunning)
+	if checkError(err) {
+		return err
+	}
+
+	return p.awaitSupervisor()
+}
+
+// reloadService reloads the service process by the supervising PRUNSRV process, or directly
+// by the PID of the service process if there is no supervising process
+func (p *Prunsrv) reloadService() error {
+	debug("reloadService")
+
+	response, err := p.control(controlReload)
+	if err == nil {
+		fmt.Println(response.Message)
+
+		return nil
+	}
+
+	if err != errNoSupervisor {
+		return err
+	}
+
+	state, _ := p.loadState()
+
+	// the PID of the state or PID file may belong to another process meanwhile
+	pid, _ := p.runningPid(state)
+	if pid <= 0 && p.ReloadClass == "" {
+		return fmt.Errorf("service %s is not running", p.DisplayName)
+	}
+
+	err = p.reloadProcess(pid)
+	if checkError(err) {
+		return err
+	}
+
+	err = p.awaitReloaded(nil)
+	if checkError(err) {
+		return err
+	}
+
+	fmt.Printf("service %s reloaded\n", p.DisplayName)
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestReloadSignal(t *testing.T) {
+	tests := []struct {
+		signal  string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{"", syscall.SIGHUP, false},
+		{"SIGHUP", syscall.SIGHUP, false},
+		{"int", syscall.SIGINT, false},
+		{"SIGKILL", 0, true},
+		{"KILL", 0, true},
+		{"SIGSTOP", 0, true},
+		{"SIGFOO", 0, true},
+	}
+
+	for _, test := range tests {
+		p := &Prunsrv{
+			ReloadSignal: test.signal,
+		}
+
+		got, err := p.reloadSignal()
+		if (err != nil) != test.wantErr {
+			t.Errorf("reloadSignal(%q): error = %v, wantErr %v", test.signal, err, test.wantErr)
+
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("reloadSignal(%q) = %v, want %v", test.signal, got, test.want)
+		}
+	}
+}
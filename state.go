@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServiceState is the runtime state of the service written by the supervising
+// PRUNSRV process, so it can be reported by other PRUNSRV invocations
+type ServiceState struct {
+	Pid            int       `json:"Pid"`
+	Started        time.Time `json:"Started"`
+	HealthCheck    string    `json:"HealthCheck,omitempty"`
+	Health         string    `json:"Health,omitempty"`
+	HealthChecked  time.Time `json:"HealthChecked"`
+	HealthFailures int       `json:"HealthFailures"`
+	HealthRestarts int       `json:"HealthRestarts"`
+	HealthError    string    `json:"HealthError,omitempty"`
+	ExitCode       int       `json:"ExitCode"`
+	Exited         time.Time `json:"Exited"`
+	Failed         bool      `json:"Failed"`
+}
+
+// stateFilenames returns the state filenames in the order they are tried, the state file is kept next to the control socket
+func (p *Prunsrv) stateFilenames() []string {
+	var filenames []string
+
+	for _, dir := range p.runtimeDirs() {
+		filenames = append(filenames, p.configFilename(dir, ".state"))
+	}
+
+	return filenames
+}
+
+func (p *Prunsrv) saveState() error {
+	debug("saveState")
+
+	p.Mu.Lock()
+	ba, err := json.MarshalIndent(p.State, "", "  ")
+	p.Mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+
+	for _, filename := range p.stateFilenames() {
+		err := writeState(filename, ba)
+		if err == nil {
+			return nil
+		}
+
+		debug("saveState:", err)
+
+		errs = append(errs, err.Error())
+	}
+
+	return fmt.Errorf("cannot write the state file: %s", strings.Join(errs, "; "))
+}
+
+func writeState(filename string, ba []byte) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a concurrent loadState never reads a partial state
+	err = ioutil.WriteFile(filename+".tmp", ba, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
+
+func (p *Prunsrv) loadState() (*ServiceState, error) {
+	debug("loadState")
+
+	var ba []byte
+	var err error
+
+	for _, filename := range p.stateFilenames() {
+		ba, err = ioutil.ReadFile(filename)
+		if err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ServiceState{}
+
+	err = json.Unmarshal(ba, state)
+	if checkError(err) {
+		return nil, err
+	}
+
+	return state, nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kardianos/service"
+)
+
+const (
+	statusRunning      = "running"
+	statusStopped      = "stopped"
+	statusFailed       = "failed"
+	statusNotInstalled = "not installed"
+
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+// statusExitCodes are the exit codes of //QS, following the LSB init script status codes
+var statusExitCodes = map[string]int{
+	statusRunning:      0,
+	statusFailed:       1,
+	statusStopped:      3,
+	statusNotInstalled: 4,
+}
+
+type ProcessInfo struct {
+	Started time.Time
+	Cpu     time.Duration
+	Rss     int64
+}
+
+type ServiceStatus struct {
+	Name      string `json:"Name"`
+	Status    string `json:"Status"`
+	Installed bool   `json:"Installed"`
+	Startup   string `json:"Startup,omitempty"`
+	JavaHome  string `json:"JavaHome,omitempty"`
+	Pid       int    `json:"Pid,omitempty"`
+	Started   string `json:"Started,omitempty"`
+	Uptime    string `json:"Uptime,omitempty"`
+	Cpu       string `json:"Cpu,omitempty"`
+	Rss       int64  `json:"Rss,omitempty"`
+	ExitCode  *int   `json:"ExitCode,omitempty"`
+	Exited    string `json:"Exited,omitempty"`
+	Health    string `json:"Health,omitempty"`
+}
+
+func parseOutput(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", outputTable:
+		return outputTable, nil
+	case outputJson:
+		return outputJson, nil
+	default:
+		return "", fmt.Errorf("unknown output: %s", s)
+	}
+}
+
+// isJsonOutput reports if the output is requested as JSON, which must not be preceded by the banner
+func isJsonOutput() bool {
+	for _, flag := range []string{"--Output", "--output"} {
+		ok, value := getFlag(flag)
+		if ok && strings.EqualFold(value, outputJson) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startupMode returns the startup mode the OS service is installed with
+func (p *Prunsrv) startupMode() string {
+	switch p.Startup {
+	case "manual", "delayed", "disabled":
+		return p.Startup
+	default:
+		return "auto"
+	}
+}
+
+// servicePid returns the PID of the service process from the PID file or the state file
+func (p *Prunsrv) servicePid(state *ServiceState) int {
+	if p.PidFile != "" {
+		ba, err := ioutil.ReadFile(p.pidFilename())
+		if err == nil {
+			pid, err := strconv.Atoi(strings.TrimSpace(string(ba)))
+			if err == nil {
+				return pid
+			}
+		}
+	}
+
+	if state != nil {
+		return state.Pid
+	}
+
+	return 0
+}
+
+// runningPid returns the PID of the running service process, or 0 if it is not running
+// or its PID has been reused by another process since the service process was started
+func (p *Prunsrv) runningPid(state *ServiceState) (int, *ProcessInfo) {
+	pid := p.servicePid(state)
+	if pid <= 0 || findProcess(pid) == nil {
+		return 0, nil
+	}
+
+	pi, err := processInfo(pid)
+	if err != nil {
+		debug("processInfo:", err)
+	}
+
+	if pi != nil && state != nil && pid == state.Pid && !state.Started.IsZero() && absDuration(pi.Started.Sub(state.Started)) > 10*time.Second {
+		debug(fmt.Sprintf("PID %d was reused by another process", pid))
+
+		return 0, nil
+	}
+
+	return pid, pi
+}
+
+func (p *Prunsrv) queryStatus() *ServiceStatus {
+	debug("queryStatus")
+
+	state, err := p.loadState()
+	if err != nil {
+		state = nil
+	}
+
+	return p.serviceStatus(state)
+}
+
+// serviceStatus returns the status of the service with the state of the supervising PRUNSRV process
+func (p *Prunsrv) serviceStatus(state *ServiceState) *ServiceStatus {
+	ss := &ServiceStatus{
+		Name:      p.DisplayName,
+		Installed: fileExists(p.configFilename(configDir(), ".json")),
+		Startup:   p.startupMode(),
+		JavaHome:  p.JavaHome,
+	}
+
+	status, err := p.Service.Status()
+	if err == service.ErrNotInstalled {
+		ss.Installed = false
+	} else if err != nil {
+		debug("service manager status:", err)
+	}
+
+	running := status == service.StatusRunning
+
+	pid, pi := p.runningPid(state)
+	if pid > 0 {
+		running = true
+
+		ss.Pid = pid
+
+		if pi != nil {
+			ss.Started = pi.Started.Format(time.RFC3339)
+			ss.Uptime = time.Since(pi.Started).Round(time.Second).String()
+			ss.Cpu = pi.Cpu.Round(time.Millisecond).String()
+			ss.Rss = pi.Rss
+		}
+	}
+
+	switch {
+	case running:
+		ss.Status = statusRunning
+	case !ss.Installed:
+		ss.Status = statusNotInstalled
+	case state != nil && state.Failed:
+		ss.Status = statusFailed
+	default:
+		ss.Status = statusStopped
+	}
+
+	if state != nil {
+		if !state.Exited.IsZero() {
+			ss.ExitCode = &state.ExitCode
+			ss.Exited = state.Exited.Format(time.RFC3339)
+		}
+
+		if running && state.HealthCheck != "" {
+			ss.Health = state.Health
+		}
+	}
+
+	return ss
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+
+	return d
+}
+
+func (ss *ServiceStatus) print() {
+	row := func(name string, value string) {
+		if value != "" {
+			fmt.Printf("%-10s %s\n", name+":", value)
+		}
+	}
+
+	row("Name", ss.Name)
+	row("Status", ss.Status)
+	row("Startup", ss.Startup)
+	row("JavaHome", ss.JavaHome)
+	if ss.Pid > 0 {
+		row("Pid", strconv.Itoa(ss.Pid))
+	}
+	row("Started", ss.Started)
+	row("Uptime", ss.Uptime)
+	row("Cpu", ss.Cpu)
+	if ss.Rss > 0 {
+		row("Rss", fmt.Sprintf("%d KB", ss.Rss/1024))
+	}
+	if ss.ExitCode != nil {
+		row("ExitCode", strconv.Itoa(*ss.ExitCode))
+	}
+	row("Exited", ss.Exited)
+	row("Health", ss.Health)
+}
+
+func (p *Prunsrv) queryService() error {
+	debug("queryService")
+
+	output, err := parseOutput(p.Output)
+	if checkError(err) {
+		return err
+	}
+
+	ss := p.status()
+
+	if output == outputJson {
+		ba, err := json.MarshalIndent(ss, "", "  ")
+		if checkError(err) {
+			return err
+		}
+
+		fmt.Println(string(ba))
+	} else {
+		ss.print()
+	}
+
+	code := statusExitCodes[ss.Status]
+	if code != 0 {
+		p.exit(code)
+	}
+
+	return nil
+}
+
+// recordExit stores the exit of the service process in the state file,
+// failed marks a service process which is not restarted anymore
+func (p *Prunsrv) recordExit(code int, failed bool) {
+	p.Mu.Lock()
+	p.State.ExitCode = code
+	p.State.Exited = time.Now()
+	p.State.Failed = failed
+	p.Mu.Unlock()
+
+	checkError(p.saveState())
+}
+
+// listServices prints the status of all services configured in configDir
+func (p *Prunsrv) listServices() error {
+	debug("listServices")
+
+	output, err := parseOutput(p.Output)
+	if checkError(err) {
+		return err
+	}
+
+	filenames, err := filepath.Glob(filepath.Join(configDir(), "*.json"))
+	if checkError(err) {
+		return err
+	}
+
+	sort.Strings(filenames)
+
+	list := []*ServiceStatus{}
+
+	for _, filename := range filenames {
+		s := &Prunsrv{
+			DisplayName: strings.TrimSuffix(filepath.Base(filename), ".json"),
+		}
+
+		err := s.loadConfig(true)
+		if checkError(err) {
+			continue
+		}
+
+		err = s.newService()
+		if checkError(err) {
+			continue
+		}
+
+		ss := s.status()
+
+		if p.ListState != "" && !strings.EqualFold(ss.Status, p.ListState) {
+			continue
+		}
+
+		if p.Startup != "" && !strings.EqualFold(ss.Startup, p.Startup) {
+			continue
+		}
+
+		list = append(list, ss)
+	}
+
+	if output == outputJson {
+		ba, err := json.MarshalIndent(list, "", "  ")
+		if checkError(err) {
+			return err
+		}
+
+		fmt.Println(string(ba))
+
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tSTATUS\tSTARTUP\tPID\tJAVAHOME")
+
+	for _, ss := range list {
+		pid := "-"
+		if ss.Pid > 0 {
+			pid = strconv.Itoa(ss.Pid)
+		}
+
+		javaHome := ss.JavaHome
+		if javaHome == "" {
+			javaHome = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", ss.Name, ss.Status, ss.Startup, pid, javaHome)
+	}
+
+	return tw.Flush()
+}
+
+var statusNames = map[service.Status]string{
+	service.StatusUnknown: "unknown",
+	service.StatusRunning: statusRunning,
+	service.StatusStopped: statusStopped,
+}
+
+// awaitStatus waits until the OS service manager reports the expected status of the service or --Wait has elapsed
+func (p *Prunsrv) awaitStatus(expected service.Status) error {
+	debug("awaitStatus:", statusNames[expected])
+
+	timeout := parseDuration(p.Wait, p.controlTimeout())
+	if timeout <= 0 {
+		return nil
+	}
+
+	started := time.Now()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		status, err := p.Service.Status()
+		if err == nil && status == expected {
+			info(fmt.Sprintf("service %s is %s after %v", p.DisplayName, statusNames[expected], time.Since(started).Round(time.Millisecond)))
+
+			return nil
+		}
+
+		// the OS service manager may report the service as stopped for a moment before it is starting
+		if expected == service.StatusRunning && err == nil && status == service.StatusStopped && time.Since(started) >= 2*time.Second {
+			return fmt.Errorf("service %s stopped while starting, see the log of the service", p.DisplayName)
+		}
+
+		if time.Since(started) >= timeout {
+			if err != nil {
+				return fmt.Errorf("service %s is not %s within %v: %v", p.DisplayName, statusNames[expected], timeout, err)
+			}
+
+			return fmt.Errorf("service %s is not %s within %v, status is %s", p.DisplayName, statusNames[expected], timeout, statusNames[status])
+		}
+
+		<-ticker.C
+	}
+}
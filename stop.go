@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	stopStepCommand = "stopclass"
+)
+
+var (
+	stopSignals = map[string]syscall.Signal{
+		"SIGHUP":  syscall.SIGHUP,
+		"SIGINT":  syscall.SIGINT,
+		"SIGQUIT": syscall.SIGQUIT,
+		"SIGKILL": syscall.SIGKILL,
+		"SIGTERM": syscall.SIGTERM,
+	}
+)
+
+type StopStep struct {
+	Action  string
+	Signal  syscall.Signal
+	Timeout time.Duration
+}
+
+func (s StopStep) String() string {
+	return fmt.Sprintf("%s:%v", s.Action, s.Timeout)
+}
+
+func (p *Prunsrv) stopTimeout() time.Duration {
+	return min(parseDuration(p.StopTimeout, 20*time.Second), time.Hour)
+}
+
+// stopSequenceTimeout is the maximum time the stop sequence may take
+func (p *Prunsrv) stopSequenceTimeout() time.Duration {
+	steps, err := p.stopSequence()
+	if err != nil {
+		return p.stopTimeout()
+	}
+
+	var timeout time.Duration
+
+	for _, step := range steps {
+		timeout += step.Timeout
+	}
+
+	return timeout
+}
+
+func (p *Prunsrv) stopSequence() ([]StopStep, error) {
+	timeout := p.stopTimeout()
+
+	if strings.TrimSpace(p.StopSequence) == "" {
+		var steps []StopStep
+
+		if p.hasStopCommand() {
+			steps = append(steps, StopStep{Action: stopStepCommand, Timeout: timeout})
+		}
+
+		// a service process ignoring the stop command still gets the chance to terminate gracefully
+		if !isWindowsOS() {
+			steps = append(steps, StopStep{Action: "SIGTERM", Signal: syscall.SIGTERM, Timeout: timeout})
+		}
+
+		return append(steps, StopStep{Action: "SIGKILL", Signal: syscall.SIGKILL, Timeout: timeout}), nil
+	}
+
+	var steps []StopStep
+
+	for _, s := range strings.Split(p.StopSequence, ",") {
+		step := StopStep{
+			Timeout: timeout,
+		}
+
+		action := strings.TrimSpace(s)
+
+		pos := strings.Index(action, ":")
+		if pos != -1 {
+			d := parseDuration(action[pos+1:], -1)
+			if d < 0 {
+				return nil, fmt.Errorf("invalid timeout in stop sequence: %s", s)
+			}
+
+			step.Timeout = d
+			action = strings.TrimSpace(action[:pos])
+		}
+
+		switch {
+		case strings.EqualFold(action, stopStepCommand) || strings.EqualFold(action, "stop"):
+			step.Action = stopStepCommand
+		default:
+			name := strings.ToUpper(action)
+			if !strings.HasPrefix(name, "SIG") {
+				name = "SIG" + name
+			}
+
+			sig, ok := stopSignals[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown step in stop sequence: %s", s)
+			}
+
+			step.Action = name
+			step.Signal = sig
+		}
+
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+func (p *Prunsrv) useCgroup() bool {
+	b, _ := strconv.ParseBool(p.Cgroup)
+
+	return b
+}
+
+// processTreeAlive reports if the service process or any process started by it is still running
+func (p *Prunsrv) processTreeAlive(pid int) bool {
+	return processGroupAlive(pid) || len(p.cgroupPids()) > 0
+}
+
+// killProcessTree kills the service process and all processes started by it
+func (p *Prunsrv) killProcessTree(pid int) {
+	debug("killProcessTree:", pid)
+
+	if processGroupAlive(pid) {
+		checkError(signalProcess(pid, syscall.SIGKILL))
+	}
+
+	if p.useCgroup() {
+		checkError(p.cgroupKill())
+	}
+}
+
+// awaitProcessTree waits until no process of the process tree of pid is left
+func (p *Prunsrv) awaitProcessTree(pid int, timeout time.Duration) error {
+	started := time.Now()
+
+	for p.processTreeAlive(pid) {
+		if time.Since(started) >= timeout {
+			return fmt.Errorf("processes of service process %d are still running after %v", pid, timeout)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// runStopCommand executes the stop command and waits at most timeout for it to finish
+func (p *Prunsrv) runStopCommand(timeout time.Duration) error {
+	debug("runStopCommand")
+
+	if !p.hasStopCommand() {
+		return fmt.Errorf("no stop command defined")
+	}
+
+	switch p.stopMode() {
+	case modePort:
+		return p.stopViaPort(timeout)
+	case modeStdin:
+		return p.stopViaStdin()
+	case modeHttp:
+		return p.stopViaHttp(timeout)
+	}
+
+	cmd, err := p.exec(false)
+	if checkError(err) {
+		return err
+	}
+
+	p.Mu.Lock()
+	p.StopCmd = cmd
+	p.Mu.Unlock()
+
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- p.waitCmd(cmd)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errCh:
+		if checkError(err) {
+			return err
+		}
+
+		return nil
+	case <-timer.C:
+		checkError(killProcess(cmd.Process.Pid))
+
+		return fmt.Errorf("stop command did not finish within %v", timeout)
+	}
+}
+
+// stopViaPort sends the StopCommand to the shutdown port of the service process
+func (p *Prunsrv) stopViaPort(timeout time.Duration) error {
+	debug("stopViaPort")
+
+	if p.StopPort == "" {
+		return fmt.Errorf("missing StopPort for mode %s", modePort)
+	}
+
+	host := p.StopHost
+	if host == "" {
+		host = "localhost"
+	}
+
+	command := p.StopCommand
+	if command == "" {
+		command = "SHUTDOWN"
+	}
+
+	address := net.JoinHostPort(host, p.StopPort)
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return fmt.Errorf("stop port %s is not listening: %v", address, err)
+	}
+	defer conn.Close()
+
+	checkError(conn.SetDeadline(time.Now().Add(timeout)))
+
+	_, err = conn.Write([]byte(command))
+	if err != nil {
+		return fmt.Errorf("cannot send stop command to stop port %s: %v", address, err)
+	}
+
+	info("stop command sent to stop port", address)
+
+	return nil
+}
+
+// stopViaStdin writes the StopStdinText to stdin of the service process
+func (p *Prunsrv) stopViaStdin() error {
+	debug("stopViaStdin")
+
+	p.Mu.Lock()
+	stdin := p.StartStdin
+	p.Mu.Unlock()
+
+	if stdin == nil {
+		return fmt.Errorf("no stdin of a service process available for mode %s", modeStdin)
+	}
+
+	text := p.StopStdinText
+	if text == "" {
+		text = "shutdown\\n"
+	}
+
+	unquoted, err := strconv.Unquote("\"" + text + "\"")
+	if err == nil {
+		text = unquoted
+	}
+
+	_, err = io.WriteString(stdin, text)
+	if err != nil {
+		return fmt.Errorf("cannot write stop text to stdin of the service process: %v", err)
+	}
+
+	info("stop text written to stdin of the service process")
+
+	return nil
+}
+
+// stopProcess executes the stop sequence step by step until the service process has terminated
+func (p *Prunsrv) stopProcess(pid int, exitCh chan struct{}) error {
+	debug("stopProcess")
+
+	steps, err := p.stopSequence()
+	if checkError(err) {
+		return err
+	}
+
+	// the service process may terminate during one step while its child processes are left until a later one
+	exited := false
+
+	for i, step := range steps {
+		info(fmt.Sprintf("stop step %d/%d: %v", i+1, len(steps), step))
+
+		var errCh chan error
+
+		if step.Action == stopStepCommand {
+			errCh = make(chan error, 1)
+
+			go func(timeout time.Duration) {
+				errCh <- p.runStopCommand(timeout)
+			}(step.Timeout)
+		} else {
+			err := signalProcess(pid, step.Signal)
+			if checkError(err) && p.processTreeAlive(pid) {
+				warn(fmt.Sprintf("stop step %d/%d: %v failed", i+1, len(steps), step))
+
+				continue
+			}
+		}
+
+		timer := time.NewTimer(step.Timeout)
+		ticker := time.NewTicker(100 * time.Millisecond)
+
+		stopped := false
+		failed := false
+
+		for !stopped && !failed {
+			select {
+			case <-exitCh:
+				exited = true
+				exitCh = nil
+				stopped = !p.processTreeAlive(pid)
+			case <-ticker.C:
+				stopped = exited && !p.processTreeAlive(pid)
+			case err := <-errCh:
+				errCh = nil
+
+				if err != nil {
+					warn(fmt.Sprintf("stop step %d/%d: %v failed: %v", i+1, len(steps), step, err))
+
+					failed = true
+				}
+			case <-timer.C:
+				failed = true
+			}
+		}
+
+		timer.Stop()
+		ticker.Stop()
+
+		if stopped {
+			info(fmt.Sprintf("stop step %d/%d: %v, service process %d stopped", i+1, len(steps), step, pid))
+
+			return nil
+		}
+
+		warn(fmt.Sprintf("stop step %d/%d: %v, service process %d did not stop", i+1, len(steps), step, pid))
+	}
+
+	return fmt.Errorf("service process %d did not stop", pid)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStopSequence(t *testing.T) {
+	tests := []struct {
+		sequence string
+		stopMode string
+		want     []StopStep
+		wantErr  bool
+	}{
+		{
+			sequence: "",
+			stopMode: modeJava,
+			want: []StopStep{
+				{Action: stopStepCommand, Timeout: 5 * time.Second},
+				{Action: "SIGTERM", Signal: syscall.SIGTERM, Timeout: 5 * time.Second},
+				{Action: "SIGKILL", Signal: syscall.SIGKILL, Timeout: 5 * time.Second},
+			},
+		},
+		{
+			sequence: "stopclass:20s, TERM:15, SIGKILL",
+			stopMode: modeJava,
+			want: []StopStep{
+				{Action: stopStepCommand, Timeout: 20 * time.Second},
+				{Action: "SIGTERM", Signal: syscall.SIGTERM, Timeout: 15 * time.Second},
+				{Action: "SIGKILL", Signal: syscall.SIGKILL, Timeout: 5 * time.Second},
+			},
+		},
+		{
+			sequence: "stop:1m,sigint:500ms",
+			stopMode: modeJava,
+			want: []StopStep{
+				{Action: stopStepCommand, Timeout: time.Minute},
+				{Action: "SIGINT", Signal: syscall.SIGINT, Timeout: 500 * time.Millisecond},
+			},
+		},
+		{
+			sequence: "SIGUSR1",
+			wantErr:  true,
+		},
+		{
+			sequence: "SIGTERM:soon",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		p := &Prunsrv{
+			StopSequence: test.sequence,
+			StopMode:     test.stopMode,
+			StopTimeout:  "5",
+		}
+
+		if isWindowsOS() && test.sequence == "" {
+			continue
+		}
+
+		got, err := p.stopSequence()
+		if (err != nil) != test.wantErr {
+			t.Errorf("stopSequence(%q): error = %v, wantErr %v", test.sequence, err, test.wantErr)
+
+			continue
+		}
+
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("stopSequence(%q) = %v, want %v", test.sequence, got, test.want)
+		}
+	}
+}
+
+func TestStopSequenceWithoutStopCommand(t *testing.T) {
+	p := &Prunsrv{
+		StartMode:   modeExe,
+		StopTimeout: "5",
+	}
+
+	steps, err := p.stopSequence()
+	if err != nil {
+		t.Fatalf("stopSequence: %v", err)
+	}
+
+	for _, step := range steps {
+		if step.Action == stopStepCommand {
+			t.Errorf("stopSequence without stop command contains %v", step)
+		}
+	}
+
+	if len(steps) == 0 || steps[len(steps)-1].Signal != syscall.SIGKILL {
+		t.Errorf("stopSequence = %v, want SIGKILL as last step", steps)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	restartNever     = "never"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+func (p *Prunsrv) restartPolicy() (string, error) {
+	switch strings.ToLower(p.Restart) {
+	case "", restartNever:
+		return restartNever, nil
+	case restartOnFailure:
+		return restartOnFailure, nil
+	case restartAlways:
+		return restartAlways, nil
+	default:
+		return "", fmt.Errorf("unknown restart policy: %s", p.Restart)
+	}
+}
+
+func (p *Prunsrv) requestStop() {
+	p.StopOnce.Do(func() {
+		close(p.StopCh)
+	})
+}
+
+func (p *Prunsrv) isStopping() bool {
+	select {
+	case <-p.StopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Prunsrv) waitService() error {
+	debug("waitService")
+
+	p.Mu.Lock()
+	cmd := p.StartCmd
+	exitCh := p.ExitCh
+	p.Mu.Unlock()
+
+	err := p.waitCmd(cmd)
+
+	// records logged after the service process has terminated must not carry its PID
+	logPid.Store(0)
+
+	close(exitCh)
+
+	return err
+}
+
+func exitCode(cmd *exec.Cmd, err error) int {
+	if cmd == nil || cmd.ProcessState == nil {
+		if err != nil {
+			return 1
+		}
+
+		return 0
+	}
+
+	code := cmd.ProcessState.ExitCode()
+	if code < 0 {
+		code = 1
+	}
+
+	return code
+}
+
+func (p *Prunsrv) exit(code int) {
+	debug("exit:", code)
+
+	if logf != nil {
+		logf.Close()
+	}
+
+	os.Exit(code)
+}
+
+func (p *Prunsrv) fail(err error) {
+	checkError(err)
+
+	p.exit(1)
+}
+
+func (p *Prunsrv) supervise() {
+	debug("supervise")
+
+	defer close(p.DoneCh)
+
+	policy, err := p.restartPolicy()
+	if checkError(err) {
+		p.fail(err)
+	}
+
+	restartDelay := parseDuration(p.RestartDelay, time.Second)
+	restartMaxDelay := max(parseDuration(p.RestartMaxDelay, time.Minute), restartDelay)
+	restartWindow := parseDuration(p.RestartWindow, 5*time.Minute)
+
+	restartMaxCount, err := parseInt(p.RestartMaxCount, 5)
+	if checkError(err) {
+		p.fail(err)
+	}
+
+	hc, err := p.healthCheck()
+	if checkError(err) {
+		p.fail(err)
+	}
+
+	delay := restartDelay
+	var restarts []time.Time
+
+	first := true
+	startFailed := false
+
+	for {
+		if !p.awaitResume() {
+			return
+		}
+
+		started := time.Now()
+
+		startCh := make(chan error, 1)
+		waitCh := make(chan error, 1)
+
+		go p.runService(startCh, waitCh)
+
+		err := <-startCh
+		if err == nil {
+			p.Mu.Lock()
+			pid := p.StartCmd.Process.Pid
+			exitCh := p.ExitCh
+			p.State.Pid = pid
+			p.State.Started = started
+			p.State.HealthFailures = 0
+			p.State.HealthError = ""
+			if hc != nil {
+				p.State.HealthCheck = hc.String()
+				p.State.Health = healthUnknown
+			}
+			p.Mu.Unlock()
+
+			checkError(p.saveState())
+
+			readyErr := p.awaitReadiness(exitCh)
+			if checkError(readyErr) {
+				if first {
+					p.requestStop()
+
+					startFailed = true
+				}
+
+				if p.stopProcess(pid, exitCh) != nil {
+					p.killProcessTree(pid)
+				}
+			}
+
+			p.notifyStarted(readyErr)
+			first = false
+
+			healthDone := make(chan struct{})
+
+			if readyErr == nil && hc != nil {
+				go func() {
+					p.monitorHealth(hc, pid, exitCh)
+					close(healthDone)
+				}()
+			} else {
+				close(healthDone)
+			}
+
+			err = <-waitCh
+
+			// an unhealthy service process is stopped by monitorHealth, wait until it is done
+			<-healthDone
+
+			if err == nil {
+				err = readyErr
+			}
+		} else {
+			if first {
+				p.requestStop()
+
+				startFailed = true
+			}
+
+			p.notifyStarted(err)
+			first = false
+		}
+
+		p.Mu.Lock()
+		cmd := p.StartCmd
+		forceRestart := p.ForceRestart
+		p.ForceRestart = false
+		hold := p.Hold
+		p.Mu.Unlock()
+
+		code := exitCode(cmd, err)
+
+		if p.isStopping() {
+			if startFailed {
+				p.recordExit(code, true)
+			}
+
+			return
+		}
+
+		// a service process stopped on request is stopped by controlStop including its child processes
+		if !hold && cmd != nil && p.processTreeAlive(cmd.Process.Pid) {
+			warn(fmt.Sprintf("service process %d left running child processes, will now kill them", cmd.Process.Pid))
+
+			p.killProcessTree(cmd.Process.Pid)
+		}
+
+		if err != nil {
+			warn("service process terminated with failure:", err)
+		} else {
+			info("service process terminated")
+		}
+
+		if hold {
+			info("service process was stopped on request")
+
+			p.recordExit(code, false)
+
+			delay = restartDelay
+
+			continue
+		}
+
+		if forceRestart {
+			info("service process is restarted regardless of the restart policy")
+		} else if policy == restartNever || (policy == restartOnFailure && err == nil) {
+			// the service process was not stopped on request, so even an exit code 0 is reported as a failure
+			info("service process will not be restarted, exit with code", max(code, 1))
+
+			p.recordExit(code, true)
+
+			p.exit(max(code, 1))
+		}
+
+		now := time.Now()
+
+		if now.Sub(started) >= restartWindow {
+			delay = restartDelay
+		}
+
+		var recent []time.Time
+		for _, t := range restarts {
+			if now.Sub(t) < restartWindow {
+				recent = append(recent, t)
+			}
+		}
+		restarts = recent
+
+		if restartMaxCount > 0 && len(restarts) >= restartMaxCount {
+			checkError(fmt.Errorf("service process restarted %d times within %v, giving up", len(restarts), restartWindow))
+
+			p.recordExit(code, true)
+
+			p.exit(max(code, 1))
+		}
+
+		restarts = append(restarts, now)
+
+		p.recordExit(code, false)
+
+		info("service process will be restarted in", delay)
+
+		select {
+		case <-p.StopCh:
+			return
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, restartMaxDelay)
+	}
+}
+
+// runService starts the service process and waits for its termination on an OS thread of its own,
+// the parent death signal of the service process is sent when the thread which started it terminates
+func (p *Prunsrv) runService(startCh chan error, waitCh chan error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	err := p.startService()
+
+	startCh <- err
+
+	if err == nil {
+		waitCh <- p.waitService()
+	}
+}
+
+// isSupervised reports if the service process is started by supervise (//RS and //TS)
+func (p *Prunsrv) isSupervised() bool {
+	return p.DoneCh != nil
+}
+
+// awaitSupervise waits until supervise has noticed the stop request and returned
+func (p *Prunsrv) awaitSupervise() {
+	select {
+	case <-p.DoneCh:
+	case <-time.After(p.stopTimeout()):
+		warn("supervising of the service process did not end within", p.stopTimeout())
+	}
+}
+
+// notifyStarted reports the result of a start of the service process to the waiting Start or control command
+func (p *Prunsrv) notifyStarted(err error) {
+	p.Mu.Lock()
+	startedCh := p.StartedCh
+	p.StartedCh = nil
+	p.Mu.Unlock()
+
+	if startedCh != nil {
+		startedCh <- err
+	}
+}
+
+// awaitResume waits while the service process is stopped by a control command,
+// it returns false if the service is stopped meanwhile
+func (p *Prunsrv) awaitResume() bool {
+	for {
+		p.Mu.Lock()
+		hold := p.Hold
+		heldCh := p.HeldCh
+		p.HeldCh = nil
+		p.Mu.Unlock()
+
+		if !hold {
+			// drop a resume of a start which happened before
+			select {
+			case <-p.ResumeCh:
+			default:
+			}
+
+			return true
+		}
+
+		if heldCh != nil {
+			info("service process is stopped, waiting for start")
+
+			close(heldCh)
+		}
+
+		select {
+		case <-p.StopCh:
+			return false
+		case <-p.ResumeCh:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// systemdScript is the unit template of kardianos/service with "Type=notify", so systemd reports the
+// service as started only after PRUNSRV has sent READY=1 when the service process is ready
+const systemdScript = `[Unit]
+Description={{.Description}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+{{range $i, $dep := .Dependencies}} 
+{{$dep}} {{end}}
+
+[Service]
+Type=notify
+NotifyAccess=main
+TimeoutStartSec=%d
+TimeoutStopSec=%d
+{{if .UserName}}RuntimeDirectory=%s/{{.Name}}{{end}}
+{{if .UserName}}RuntimeDirectoryPreserve=yes{{end}}
+StartLimitInterval=5
+StartLimitBurst=10
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+{{if .ChRoot}}RootDirectory={{.ChRoot|cmd}}{{end}}
+{{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|cmdEscape}}{{end}}
+{{if .UserName}}User={{.UserName}}{{end}}
+{{if .ReloadSignal}}ExecReload=/bin/kill -{{.ReloadSignal}} "$MAINPID"{{end}}
+{{if .PIDFile}}PIDFile={{.PIDFile|cmd}}{{end}}
+{{if and .LogOutput .HasOutputFileSupport -}}
+StandardOutput=file:{{.LogDirectory}}/{{.Name}}.out
+StandardError=file:{{.LogDirectory}}/{{.Name}}.err
+{{- end}}
+{{if gt .LimitNOFILE -1 }}LimitNOFILE={{.LimitNOFILE}}{{end}}
+{{if .Restart}}Restart={{.Restart}}{{end}}
+{{if .SuccessExitStatus}}SuccessExitStatus={{.SuccessExitStatus}}{{end}}
+RestartSec=120
+EnvironmentFile=-/etc/sysconfig/{{.Name}}
+
+{{range $k, $v := .EnvVars -}}
+Environment={{$k}}={{$v}}
+{{end -}}
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// systemdUnit returns the unit template, systemd waits for READY=1 a bit longer than the StartTimeout and for the
+// stop a bit longer than the whole stop sequence. It creates the runtime directory for a ServiceUser, which is
+// kept after the stop for the state file
+func (p *Prunsrv) systemdUnit() string {
+	return fmt.Sprintf(systemdScript, int((p.startTimeout()+30*time.Second)/time.Second), int((p.stopSequenceTimeout()+30*time.Second)/time.Second), title())
+}
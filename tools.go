@@ -1,110 +1,137 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"golang.org/x/exp/constraints"
-	"golang.org/x/sys/windows"
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 	"unicode"
 )
 
-var (
-	lastError string
-	logf      *os.File
-	mu        sync.Mutex
-	isDebug   bool
-
-	initLogs = &[]string{}
+const (
+	levelError = iota
+	levelWarn
+	levelInfo
+	levelDebug
+	levelTrace
 )
 
-func createLogFile(filename string) (*os.File, error) {
-	dir := filepath.Dir(filename)
-	if !fileExists(dir) {
-		err := os.MkdirAll(dir, os.ModePerm)
-		if checkError(err) {
-			return nil, err
-		}
-	}
+type initLog struct {
+	level int
+	msg   string
+}
 
-	if fileExists(filename) {
-		fs, err := os.Stat(filename)
-		if checkError(err) {
-			return nil, err
-		}
+var (
+	logf     *RotateWriter
+	mu       sync.Mutex
+	logLevel = levelInfo
 
-		if fs.Size() > 10000000 {
-			debug(fmt.Sprintf("truncate log file %s ", filename))
+	levelNames = []string{"ERROR", "WARN", "INFO", "DEBUG", "TRACE"}
 
-			err = os.Remove(filename)
-			if checkError(err) {
-				return nil, err
-			}
-		}
+	initLogs = &[]initLog{}
+)
+
+func parseLogLevel(s string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "error":
+		return levelError, nil
+	case "warn", "warning":
+		return levelWarn, nil
+	case "", "info":
+		return levelInfo, nil
+	case "debug":
+		return levelDebug, nil
+	case "trace":
+		return levelTrace, nil
+	default:
+		return levelInfo, fmt.Errorf("unknown log level: %s", s)
 	}
+}
 
+func createLogFile(filename string, options RotateOptions) (*RotateWriter, error) {
 	var err error
 
-	logf, err = os.OpenFile(filename, os.O_APPEND|os.O_RDWR|os.O_CREATE, os.ModePerm)
+	logf, err = NewRotateWriter(filename, false, options)
 	if checkError(err) {
 		return nil, err
 	}
 
-	for _, l := range *initLogs {
-		log.Printf(l)
+	return logf, nil
+}
+
+// flushInitLogs writes the messages logged before the log file and the
+// log level were known to the log file
+func flushInitLogs() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if logf != nil && initLogs != nil {
+		l := log.New(logf, log.Prefix(), log.Flags())
+
+		for _, entry := range *initLogs {
+			if entry.level <= logLevel {
+				l.Print(formatLog(entry.level, entry.msg))
+			}
+		}
 	}
 
-	return logf, nil
+	initLogs = nil
 }
 
-func rerunElevated() error {
-	debug("rerun elevated")
+func logMessage(level int, values ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
 
-	verb := "runas"
-	exe, _ := os.Executable()
-	cwd, _ := os.Getwd()
-	args := strings.Join(os.Args[1:], " ")
+	if level > logLevel && initLogs == nil {
+		return
+	}
 
-	verbPtr, _ := syscall.UTF16PtrFromString(verb)
-	exePtr, _ := syscall.UTF16PtrFromString(exe)
-	cwdPtr, _ := syscall.UTF16PtrFromString(cwd)
-	argPtr, _ := syscall.UTF16PtrFromString(args)
+	var a []string
 
-	var showCmd int32 = 1 //SW_NORMAL
+	for _, value := range values {
+		a = append(a, fmt.Sprintf("%+v", value))
+	}
 
-	err := windows.ShellExecute(0, verbPtr, exePtr, argPtr, cwdPtr, showCmd)
-	if checkError(err) {
-		return err
+	s := strings.Join(a, " ")
+	if initLogs != nil {
+		*initLogs = append(*initLogs, initLog{level, s})
 	}
 
-	return nil
+	if level <= logLevel {
+		log.Print(formatLog(level, s))
+	}
 }
 
-func isAdmin() bool {
-	_, err := os.Open("\\\\.\\PHYSICALDRIVE0")
-	if err != nil {
-		debug("is running elevated: no")
-		return false
+// checkAdmin reruns PRUNSRV elevated if it lacks administrator privileges and exits with the
+// exit code of the elevated process, elevate enables the rerun via "sudo" or "pkexec" on *nix
+func checkAdmin(elevate bool) error {
+	if isAdmin() {
+		return nil
 	}
 
-	debug("is running elevated: yes")
+	code, err := rerunElevated(elevate)
+	if checkError(err) {
+		return fmt.Errorf("administrator privileges are required: %v", err)
+	}
 
-	return true
-}
+	debug("action is performed by the elevated process, exit with code", code)
 
-func checkAdmin() {
-	if !isAdmin() {
-		checkError(rerunElevated())
+	if logf != nil {
+		logf.Close()
 	}
+
+	os.Exit(code)
+
+	return nil
 }
 
 func getFlag(flag string) (bool, string) {
@@ -130,63 +157,42 @@ func getFlag(flag string) (bool, string) {
 	return false, ""
 }
 
+// checkError logs err if there is one, a repeated error is logged again
 func checkError(err error) bool {
-	mu.Lock()
-	defer mu.Unlock()
-
-	if err == nil || err.Error() == lastError {
-		return err != nil
-	}
-
-	lastError = err.Error()
-
-	var s string
-
-	if isDebug {
-		s = fmt.Sprintf("%s %s", "ERROR", err.Error())
-		log.Printf(s)
-	} else {
-		s = err.Error()
-		fmt.Fprint(os.Stderr, s+"\n")
+	if err == nil {
+		return false
 	}
 
-	if initLogs != nil {
-		*initLogs = append(*initLogs, s)
-	}
+	logMessage(levelError, err.Error())
 
 	return true
 }
 
-func debug(values ...interface{}) {
-	if !isDebug {
-		return
-	}
-
-	mu.Lock()
-	defer mu.Unlock()
-
-	var a []string
+func warn(values ...interface{}) {
+	logMessage(levelWarn, values...)
+}
 
-	for _, value := range values {
-		a = append(a, fmt.Sprintf("%+v", reflect.ValueOf(value)))
-	}
+func info(values ...interface{}) {
+	logMessage(levelInfo, values...)
+}
 
-	s := fmt.Sprintf("%s %s", "DEBUG", strings.Join(a, " "))
-	if initLogs != nil {
-		*initLogs = append(*initLogs, s)
-	}
+func debug(values ...interface{}) {
+	logMessage(levelDebug, values...)
+}
 
-	log.Printf(s)
+func trace(values ...interface{}) {
+	logMessage(levelTrace, values...)
 }
 
 func isWindowsOS() bool {
 	b := runtime.GOOS == "windows"
 
-	debug("isWindowsOs:", b)
+	trace("isWindowsOs:", b)
 
 	return b
 }
 
+// fileExists must not log as it is called by the RotateWriter while the log file is written
 func fileExists(filename string) bool {
 	_, err := os.Stat(filename)
 
@@ -198,20 +204,18 @@ func fileExists(filename string) bool {
 		b = true
 	}
 
-	debug("fileExists:", filename, b)
-
 	return b
 }
 
 func javaExecutable() string {
 	var s string
 	if isWindowsOS() {
-		s = "java"
+		s = "java.exe"
 	} else {
 		s = "java"
 	}
 
-	debug("javaExecutable:", s)
+	trace("javaExecutable:", s)
 
 	return s
 }
@@ -238,7 +242,7 @@ func title() string {
 		}
 	}
 
-	debug("title:", title)
+	trace("title:", title)
 
 	return title
 }
@@ -249,11 +253,39 @@ func surroundWidth(strs []string, surround string) []string {
 		resultStrs = append(resultStrs, fmt.Sprintf("\"%s\"", str))
 	}
 
-	debug("surroundWidth:", resultStrs)
+	trace("surroundWidth:", resultStrs)
 
 	return resultStrs
 }
 
+func parseDuration(s string, def time.Duration) time.Duration {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def
+	}
+
+	seconds, err := strconv.Atoi(s)
+	if err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	d, err := time.ParseDuration(s)
+	if checkError(err) {
+		return def
+	}
+
+	return d
+}
+
+func parseInt(s string, def int) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(s)
+}
+
 func max[T constraints.Ordered](v0 T, v1 T) T {
 	if v0 > v1 {
 		return v0
@@ -276,19 +308,13 @@ func killProcess(pid int) error {
 		return nil
 	}
 
-	var cmd *exec.Cmd
-	if isWindowsOS() {
-		cmd = exec.Command("taskkill", "/f", "/pid", strconv.Itoa(pid))
-	} else {
-		cmd = exec.Command("kill", "-9", strconv.Itoa(pid))
-	}
-
-	debug("killProcess:", strings.Join(surroundWidth(append([]string{cmd.Path}, cmd.Args...), "\""), " "))
+	debug("killProcess:", pid)
 
-	err := cmd.Run()
+	err := p.Kill()
 	if checkError(err) {
 		return err
 	}
+
 	return nil
 }
 
@@ -297,8 +323,12 @@ func findProcess(pid int) *os.Process {
 	if err != nil {
 		process = nil
 	} else {
-		if !isWindowsOS() && process.Signal(syscall.Signal(0)) != nil {
-			process = nil
+		// EPERM is returned for a running process of another user, e.g. a service run as root
+		if !isWindowsOS() {
+			err := process.Signal(syscall.Signal(0))
+			if err != nil && !errors.Is(err, syscall.EPERM) {
+				process = nil
+			}
 		}
 	}
 
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		def  time.Duration
+		want time.Duration
+	}{
+		{"", 20 * time.Second, 20 * time.Second},
+		{"30", 0, 30 * time.Second},
+		{" 5 ", 0, 5 * time.Second},
+		{"0", time.Second, 0},
+		{"500ms", 0, 500 * time.Millisecond},
+		{"1m30s", 0, 90 * time.Second},
+		{"2h", 0, 2 * time.Hour},
+		{"soon", time.Minute, time.Minute},
+	}
+
+	for _, test := range tests {
+		got := parseDuration(test.s, test.def)
+		if got != test.want {
+			t.Errorf("parseDuration(%q, %v) = %v, want %v", test.s, test.def, got, test.want)
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		s       string
+		def     int
+		want    int
+		wantErr bool
+	}{
+		{"", 5, 5, false},
+		{"0", 5, 0, false},
+		{" 12 ", 5, 12, false},
+		{"-1", 5, -1, false},
+		{"many", 5, 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseInt(test.s, test.def)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseInt(%q): error = %v, wantErr %v", test.s, err, test.wantErr)
+
+			continue
+		}
+
+		if !test.wantErr && got != test.want {
+			t.Errorf("parseInt(%q, %d) = %d, want %d", test.s, test.def, got, test.want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		def     int64
+		want    int64
+		wantErr bool
+	}{
+		{"", 10000000, 10000000, false},
+		{"1000", 0, 1000, false},
+		{"10k", 0, 10 * 1024, false},
+		{"10K", 0, 10 * 1024, false},
+		{"5m", 0, 5 * 1024 * 1024, false},
+		{" 2G ", 0, 2 * 1024 * 1024 * 1024, false},
+		{"m", 0, 0, true},
+		{"10mb", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseSize(test.s, test.def)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseSize(%q): error = %v, wantErr %v", test.s, err, test.wantErr)
+
+			continue
+		}
+
+		if !test.wantErr && got != test.want {
+			t.Errorf("parseSize(%q, %d) = %d, want %d", test.s, test.def, got, test.want)
+		}
+	}
+}
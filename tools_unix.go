@@ -0,0 +1,103 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/kardianos/service"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	capSysAdmin = 21
+)
+
+// rerunElevated replaces PRUNSRV by itself run via "sudo" or "pkexec", it only returns on failure
+func rerunElevated(elevate bool) (int, error) {
+	debug("rerun elevated")
+
+	if !elevate {
+		return 0, fmt.Errorf("please run as root or rerun with --Elevate to use sudo or pkexec")
+	}
+
+	if !service.Interactive() {
+		return 0, fmt.Errorf("cannot rerun elevated in a non-interactive session, please run as root")
+	}
+
+	exe, err := os.Executable()
+	if checkError(err) {
+		return 0, err
+	}
+
+	var errs []string
+
+	for _, elevator := range []string{"sudo", "pkexec"} {
+		path, err := exec.LookPath(elevator)
+		if err != nil {
+			errs = append(errs, err.Error())
+
+			continue
+		}
+
+		args := append([]string{elevator, exe}, os.Args[1:]...)
+
+		debug("rerun elevated:", strings.Join(surroundWidth(args, "\""), " "))
+
+		// replaces the current process, only returns on failure
+		err = syscall.Exec(path, args, os.Environ())
+
+		warn(fmt.Sprintf("cannot rerun elevated by %s: %v", elevator, err))
+
+		errs = append(errs, fmt.Sprintf("%s: %v", elevator, err))
+	}
+
+	return 0, fmt.Errorf("neither sudo nor pkexec could be used (%s), please run as root", strings.Join(errs, "; "))
+}
+
+func hasCapSysAdmin() bool {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			return false
+		}
+
+		return caps&(1<<capSysAdmin) != 0
+	}
+
+	return false
+}
+
+func isAdmin() bool {
+	if os.Geteuid() != 0 && !hasCapSysAdmin() {
+		debug("is running elevated: no")
+		return false
+	}
+
+	debug("is running elevated: yes")
+
+	return true
+}
+
+// isConnectionRefused reports if nobody listens on the socket
+func isConnectionRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/windows"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	seeMaskNoCloseProcess = 0x00000040
+	seeMaskNoAsync        = 0x00000100
+)
+
+// shellExecuteInfo is the SHELLEXECUTEINFOW structure of ShellExecuteExW
+type shellExecuteInfo struct {
+	cbSize       uint32
+	fMask        uint32
+	hwnd         windows.Handle
+	lpVerb       *uint16
+	lpFile       *uint16
+	lpParameters *uint16
+	lpDirectory  *uint16
+	nShow        int32
+	hInstApp     windows.Handle
+	lpIDList     uintptr
+	lpClass      *uint16
+	hkeyClass    windows.Handle
+	dwHotKey     uint32
+	hIcon        windows.Handle
+	hProcess     windows.Handle
+}
+
+var procShellExecuteEx = windows.NewLazySystemDLL("shell32.dll").NewProc("ShellExecuteExW")
+
+// rerunElevated reruns PRUNSRV via UAC, which always asks the user, and waits for the elevated process
+func rerunElevated(elevate bool) (int, error) {
+	debug("rerun elevated")
+
+	exe, _ := os.Executable()
+	cwd, _ := os.Getwd()
+
+	var args []string
+	for _, arg := range os.Args[1:] {
+		args = append(args, windows.EscapeArg(arg))
+	}
+
+	verbPtr, _ := syscall.UTF16PtrFromString("runas")
+	exePtr, _ := syscall.UTF16PtrFromString(exe)
+	cwdPtr, _ := syscall.UTF16PtrFromString(cwd)
+	argPtr, _ := syscall.UTF16PtrFromString(strings.Join(args, " "))
+
+	sei := &shellExecuteInfo{
+		fMask:        seeMaskNoCloseProcess | seeMaskNoAsync,
+		lpVerb:       verbPtr,
+		lpFile:       exePtr,
+		lpParameters: argPtr,
+		lpDirectory:  cwdPtr,
+		nShow:        windows.SW_NORMAL,
+	}
+	sei.cbSize = uint32(unsafe.Sizeof(*sei))
+
+	r, _, err := procShellExecuteEx.Call(uintptr(unsafe.Pointer(sei)))
+	if r == 0 {
+		checkError(err)
+
+		return 0, err
+	}
+
+	if sei.hProcess == 0 {
+		return 0, fmt.Errorf("no elevated process was started")
+	}
+	defer windows.CloseHandle(sei.hProcess)
+
+	_, err = windows.WaitForSingleObject(sei.hProcess, windows.INFINITE)
+	if checkError(err) {
+		return 0, err
+	}
+
+	var code uint32
+
+	err = windows.GetExitCodeProcess(sei.hProcess, &code)
+	if checkError(err) {
+		return 0, err
+	}
+
+	return int(code), nil
+}
+
+func isAdmin() bool {
+	f, err := os.Open("\\\\.\\PHYSICALDRIVE0")
+	if err != nil {
+		debug("is running elevated: no")
+		return false
+	}
+
+	f.Close()
+
+	debug("is running elevated: yes")
+
+	return true
+}
+
+// isConnectionRefused reports if nobody listens on the socket
+func isConnectionRefused(err error) bool {
+	return errors.Is(err, windows.WSAECONNREFUSED)
+}